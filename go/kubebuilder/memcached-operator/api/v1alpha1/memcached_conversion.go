@@ -0,0 +1,169 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/example-inc/memcached-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &Memcached{}
+
+// ConvertTo converts this Memcached to the Hub version (v1beta1).
+func (src *Memcached) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Memcached)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = v1beta1.MemcachedSpec{
+		Replicas:     src.Spec.Size,
+		WorkloadType: v1beta1.WorkloadType(src.Spec.WorkloadType),
+		Cache: v1beta1.CacheSpec{
+			Image:     src.Spec.Image,
+			Version:   src.Spec.Version,
+			Memory:    src.Spec.Memory,
+			Resources: src.Spec.Resources,
+			Config:    (*v1beta1.Config)(src.Spec.Config),
+		},
+		Service: v1beta1.ServiceSpec{
+			Headless: src.Spec.HeadlessService,
+		},
+		DisruptionBudget:       (*v1beta1.DisruptionBudget)(src.Spec.DisruptionBudget),
+		Autoscaling:            (*v1beta1.Autoscaling)(src.Spec.Autoscaling),
+		Probe:                  (*v1beta1.Probe)(src.Spec.Probe),
+		DeletionPolicy:         v1beta1.DeletionPolicy(src.Spec.DeletionPolicy),
+		TeardownTimeoutSeconds: src.Spec.TeardownTimeoutSeconds,
+		TLS:                    (*v1beta1.TLS)(src.Spec.TLS),
+		Access:                 (*v1beta1.Access)(src.Spec.Access),
+		RestartedAt:            src.Spec.RestartedAt,
+	}
+	if src.Spec.Auth != nil {
+		dst.Spec.Auth = &v1beta1.Auth{SASL: (*v1beta1.SASLAuth)(src.Spec.Auth.SASL)}
+	}
+	if p := src.Spec.Placement; p != nil {
+		dst.Spec.Placement = &v1beta1.Placement{
+			AntiAffinity:      v1beta1.AntiAffinity(p.AntiAffinity),
+			ZoneSpread:        (*v1beta1.TopologySpread)(p.ZoneSpread),
+			HostSpread:        (*v1beta1.TopologySpread)(p.HostSpread),
+			NodeSelector:      p.NodeSelector,
+			Tolerations:       p.Tolerations,
+			PriorityClassName: p.PriorityClassName,
+		}
+	}
+
+	dst.Status = v1beta1.MemcachedStatus{
+		Nodes:              src.Status.Nodes,
+		CurrentVersion:     src.Status.CurrentVersion,
+		TargetVersion:      src.Status.TargetVersion,
+		ActiveUsers:        src.Status.ActiveUsers,
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Replicas:           src.Status.Replicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		Selector:           src.Status.Selector,
+		LastRestartTime:    src.Status.LastRestartTime,
+		ConnectionInfo:     (*v1beta1.ConnectionInfoReference)(src.Status.ConnectionInfo),
+	}
+	if src.Status.Members != nil {
+		dst.Status.Members = make([]v1beta1.MemberStatus, len(src.Status.Members))
+		for i, member := range src.Status.Members {
+			dst.Status.Members[i] = v1beta1.MemberStatus(member)
+		}
+	}
+	if src.Status.Zones != nil {
+		dst.Status.Zones = make([]v1beta1.ZoneStatus, len(src.Status.Zones))
+		for i, zone := range src.Status.Zones {
+			dst.Status.Zones[i] = v1beta1.ZoneStatus(zone)
+		}
+	}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]v1beta1.Condition, len(src.Status.Conditions))
+		for i, c := range src.Status.Conditions {
+			dst.Status.Conditions[i] = v1beta1.Condition(c)
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *Memcached) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Memcached)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = MemcachedSpec{
+		Size:                   src.Spec.Replicas,
+		Image:                  src.Spec.Cache.Image,
+		Version:                src.Spec.Cache.Version,
+		Memory:                 src.Spec.Cache.Memory,
+		Resources:              src.Spec.Cache.Resources,
+		Config:                 (*Config)(src.Spec.Cache.Config),
+		HeadlessService:        src.Spec.Service.Headless,
+		WorkloadType:           WorkloadType(src.Spec.WorkloadType),
+		DisruptionBudget:       (*DisruptionBudget)(src.Spec.DisruptionBudget),
+		Autoscaling:            (*Autoscaling)(src.Spec.Autoscaling),
+		Probe:                  (*Probe)(src.Spec.Probe),
+		DeletionPolicy:         DeletionPolicy(src.Spec.DeletionPolicy),
+		TeardownTimeoutSeconds: src.Spec.TeardownTimeoutSeconds,
+		TLS:                    (*TLS)(src.Spec.TLS),
+		Access:                 (*Access)(src.Spec.Access),
+		RestartedAt:            src.Spec.RestartedAt,
+	}
+	if src.Spec.Auth != nil {
+		dst.Spec.Auth = &Auth{SASL: (*SASLAuth)(src.Spec.Auth.SASL)}
+	}
+	if p := src.Spec.Placement; p != nil {
+		dst.Spec.Placement = &Placement{
+			AntiAffinity:      AntiAffinity(p.AntiAffinity),
+			ZoneSpread:        (*TopologySpread)(p.ZoneSpread),
+			HostSpread:        (*TopologySpread)(p.HostSpread),
+			NodeSelector:      p.NodeSelector,
+			Tolerations:       p.Tolerations,
+			PriorityClassName: p.PriorityClassName,
+		}
+	}
+
+	dst.Status = MemcachedStatus{
+		Nodes:              src.Status.Nodes,
+		CurrentVersion:     src.Status.CurrentVersion,
+		TargetVersion:      src.Status.TargetVersion,
+		ActiveUsers:        src.Status.ActiveUsers,
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Replicas:           src.Status.Replicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		Selector:           src.Status.Selector,
+		LastRestartTime:    src.Status.LastRestartTime,
+		ConnectionInfo:     (*ConnectionInfoReference)(src.Status.ConnectionInfo),
+	}
+	if src.Status.Members != nil {
+		dst.Status.Members = make([]MemberStatus, len(src.Status.Members))
+		for i, member := range src.Status.Members {
+			dst.Status.Members[i] = MemberStatus(member)
+		}
+	}
+	if src.Status.Zones != nil {
+		dst.Status.Zones = make([]ZoneStatus, len(src.Status.Zones))
+		for i, zone := range src.Status.Zones {
+			dst.Status.Zones[i] = ZoneStatus(zone)
+		}
+	}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]Condition, len(src.Status.Conditions))
+		for i, c := range src.Status.Conditions {
+			dst.Status.Conditions[i] = Condition(c)
+		}
+	}
+	return nil
+}
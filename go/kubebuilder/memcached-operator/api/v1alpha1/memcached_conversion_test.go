@@ -0,0 +1,95 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"math/rand"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/example-inc/memcached-operator/api/v1beta1"
+)
+
+// fuzzIterations is the number of random objects converted by each round-trip test
+const fuzzIterations = 1000
+
+// newFuzzer returns a fuzzer filling every field of the Memcached versions with valid values.
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.2).NumElements(0, 3).RandSource(rand.NewSource(seed)).Funcs(
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1<<40), resource.BinarySI)
+		},
+		func(v *intstr.IntOrString, c fuzz.Continue) {
+			if c.RandBool() {
+				*v = intstr.FromInt(c.Intn(100))
+			} else {
+				*v = intstr.FromString(c.RandString())
+			}
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+		// TypeMeta is set by the conversion webhook, not by the conversion functions
+		func(t *metav1.TypeMeta, c fuzz.Continue) {},
+	)
+}
+
+func TestMemcachedRoundTripFromSpoke(t *testing.T) {
+	f := newFuzzer(1)
+	for i := 0; i < fuzzIterations; i++ {
+		src := &Memcached{}
+		f.Fuzz(src)
+
+		hub := &v1beta1.Memcached{}
+		if err := src.ConvertTo(hub); err != nil {
+			t.Fatalf("convert to hub: (%v)", err)
+		}
+		dst := &Memcached{}
+		if err := dst.ConvertFrom(hub); err != nil {
+			t.Fatalf("convert from hub: (%v)", err)
+		}
+		if !equality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1alpha1 Memcached changed in a round trip through v1beta1:\n%s", diff.ObjectReflectDiff(src, dst))
+		}
+	}
+}
+
+func TestMemcachedRoundTripFromHub(t *testing.T) {
+	f := newFuzzer(2)
+	for i := 0; i < fuzzIterations; i++ {
+		src := &v1beta1.Memcached{}
+		f.Fuzz(src)
+
+		spoke := &Memcached{}
+		if err := spoke.ConvertFrom(src); err != nil {
+			t.Fatalf("convert from hub: (%v)", err)
+		}
+		dst := &v1beta1.Memcached{}
+		if err := spoke.ConvertTo(dst); err != nil {
+			t.Fatalf("convert to hub: (%v)", err)
+		}
+		if !equality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1beta1 Memcached changed in a round trip through v1alpha1:\n%s", diff.ObjectReflectDiff(src, dst))
+		}
+	}
+}
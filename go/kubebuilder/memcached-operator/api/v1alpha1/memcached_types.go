@@ -17,12 +17,82 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	// DefaultImage is the memcached image used when Spec.Image is empty
+	DefaultImage = "memcached"
+	// DefaultVersion is the memcached image tag used when Spec.Version is empty
+	DefaultVersion = "1.4.36-alpine"
+	// DefaultMemoryMB is the memcached cache size in megabytes used when Spec.Memory is empty
+	DefaultMemoryMB = 64
+	// MinMemoryOverheadMB is the least memory reserved on top of the cache for connections and slab overhead
+	MinMemoryOverheadMB = 32
+	// DefaultTargetCPUUtilizationPercentage is the CPU utilization the autoscaler aims for when no target is set
+	DefaultTargetCPUUtilizationPercentage = 80
+	// DefaultProbePeriodSeconds is how often members are probed when Probe.PeriodSeconds is empty
+	DefaultProbePeriodSeconds = 30
+	// DefaultProbeTimeoutSeconds is how long members have to answer a probe when Probe.TimeoutSeconds is empty
+	DefaultProbeTimeoutSeconds = 1
+	// DefaultTeardownTimeoutSeconds is how long the teardown of a deleted CR may take when Spec.TeardownTimeoutSeconds is empty
+	DefaultTeardownTimeoutSeconds = 300
+	// DefaultCertificateDuration is how long the certificates issued by the operator are valid when TLS.CertificateDuration is empty
+	DefaultCertificateDuration = 90 * 24 * time.Hour
+	// MinCertificateDuration is the shortest validity of the certificates issued by the operator
+	MinCertificateDuration = time.Hour
+	// MinTLSVersion is the first memcached version able to serve TLS
+	MinTLSVersion = "1.5.13"
+	// MinNoModernOptionsVersion is the first memcached version able to disable the options enabled by
+	// the modern option, with their no_ counterparts
+	MinNoModernOptionsVersion = "1.5.0"
+	// MinMaxItemSize is the smallest item size limit memcached accepts
+	MinMaxItemSize = 1024
+	// MaxMaxItemSize is the largest item size limit memcached accepts
+	MaxMaxItemSize = 1024 * 1024 * 1024
+	// MaxLRUPercent is the most memory the hot and warm LRUs may take together, in percent
+	MaxLRUPercent = 80
+	// PausedAnnotation pauses the reconciliation of a Memcached while it is set, whatever its
+	// value, so its owned objects can be edited by hand
+	PausedAnnotation = "cache.example.com/paused"
+)
+
+// WorkloadType is the kind of workload running the memcached pods
+// +kubebuilder:validation:Enum=Deployment;StatefulSet
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment runs the memcached pods in a Deployment
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet runs the memcached pods in a StatefulSet, giving them stable
+	// names and DNS records through the governing headless Service
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+)
+
+// DeletionPolicy is what the operator does with the cached data when a Memcached is deleted
+// +kubebuilder:validation:Enum=Delete;Flush
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete releases the members with the data they cache
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyFlush invalidates every item cached by the members with flush_all before
+	// releasing them, for caches holding sensitive data
+	DeletionPolicyFlush DeletionPolicy = "Flush"
+)
+
 // MemcachedSpec defines the desired state of Memcached
 type MemcachedSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -31,6 +101,306 @@ type MemcachedSpec struct {
 	// +kubebuilder:validation:Minimum=0
 	// Size is the size of the memcached deployment
 	Size int32 `json:"size"`
+
+	// Image is the memcached container image, without a tag
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version is the tag of the memcached image to run, e.g. 1.5.20-alpine
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Memory is the size of the cache, passed to memcached as -m.
+	// The container memory is sized to fit it plus connection and slab overhead.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// Resources overrides the computed resource requirements of the memcached container
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Config tunes the memcached server. Changing it rolls the members.
+	// +optional
+	Config *Config `json:"config,omitempty"`
+
+	// HeadlessService also exposes the members through a headless Service named
+	// <name>-headless, so client-side consistent hashing libraries get a DNS record per pod
+	// +optional
+	HeadlessService bool `json:"headlessService,omitempty"`
+
+	// WorkloadType is the kind of workload running the memcached pods, Deployment or StatefulSet.
+	// It cannot be changed once set.
+	// +optional
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// DisruptionBudget bounds the members voluntary disruptions such as node drains may evict.
+	// When it is omitted at most one member may be unavailable at a time.
+	// +optional
+	DisruptionBudget *DisruptionBudget `json:"disruptionBudget,omitempty"`
+
+	// Autoscaling lets a HorizontalPodAutoscaler owned by the operator choose Size
+	// through the scale subresource, within the given bounds.
+	// +optional
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
+	// Probe makes the operator check the members answer memcached protocol requests,
+	// reporting their reachability, version and uptime in the member status
+	// +optional
+	Probe *Probe `json:"probe,omitempty"`
+
+	// DeletionPolicy is what the operator does with the cached data when the CR is deleted,
+	// Delete or Flush. The published connection info is removed with either policy.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// TeardownTimeoutSeconds bounds the teardown run when the CR is deleted. Once it is
+	// exceeded the remaining steps are skipped and the CR is released, so a stuck teardown
+	// cannot block the deletion of its namespace
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TeardownTimeoutSeconds int32 `json:"teardownTimeoutSeconds,omitempty"`
+
+	// Auth configures how clients authenticate to the members
+	// +optional
+	Auth *Auth `json:"auth,omitempty"`
+
+	// TLS serves the members over TLS only. It requires memcached 1.5.13 or later built with TLS support.
+	// +optional
+	TLS *TLS `json:"tls,omitempty"`
+
+	// Access restricts the clients allowed to connect to the members with a NetworkPolicy owned
+	// by the operator. Any pod of the cluster may connect when it is omitted.
+	// +optional
+	Access *Access `json:"access,omitempty"`
+
+	// Placement controls which nodes the members are scheduled on and how they are spread
+	// across them. Changing it rolls the members.
+	// +optional
+	Placement *Placement `json:"placement,omitempty"`
+
+	// RestartedAt restarts every member when it is set to a new time, like kubectl rollout restart
+	// +optional
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+}
+
+// Config configures the memcached server flags. Omitted fields keep the memcached defaults,
+// with the options of -o modern enabled.
+type Config struct {
+	// Threads is the number of worker threads, passed as -t
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Threads *int32 `json:"threads,omitempty"`
+
+	// MaxConnections is the most simultaneous client connections, passed as -c
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+
+	// MaxItemSize is the size of the largest item, passed as -I. It must be between 1Ki and 1Gi,
+	// and at most half of the cache memory.
+	// +optional
+	MaxItemSize *resource.Quantity `json:"maxItemSize,omitempty"`
+
+	// ListenBacklog is the length of the queue of pending connections, passed as -b
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ListenBacklog *int32 `json:"listenBacklog,omitempty"`
+
+	// LRUCrawler reclaims the memory of expired items in the background. Disabling it
+	// requires memcached 1.5.0 or later.
+	// +optional
+	LRUCrawler *bool `json:"lruCrawler,omitempty"`
+
+	// LRUMaintainer moves items between the hot, warm and cold LRUs in the background.
+	// Disabling it requires memcached 1.5.0 or later.
+	// +optional
+	LRUMaintainer *bool `json:"lruMaintainer,omitempty"`
+
+	// HotLRUPercent is the most memory of a slab class the hot LRU may take, in percent.
+	// It requires the LRU maintainer.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=80
+	// +optional
+	HotLRUPercent *int32 `json:"hotLRUPercent,omitempty"`
+
+	// WarmLRUPercent is the most memory of a slab class the warm LRU may take, in percent.
+	// It requires the LRU maintainer, and at most 80 percent may go to the hot and warm LRUs.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=80
+	// +optional
+	WarmLRUPercent *int32 `json:"warmLRUPercent,omitempty"`
+
+	// SlabAutomove is how eagerly memory is moved between slab classes, 0 never, 1 when a class
+	// keeps evicting or 2 on every eviction
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=2
+	// +optional
+	SlabAutomove *int32 `json:"slabAutomove,omitempty"`
+
+	// SlabAutomoveWindow is the number of seconds of slab statistics the automover decides on.
+	// It requires the slab automover.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SlabAutomoveWindow *int32 `json:"slabAutomoveWindow,omitempty"`
+
+	// ExtendedOptions are passed with -o, as key=value or as the bare key when the value is empty.
+	// Options set by the other fields or by the operator cannot be overridden.
+	// +optional
+	ExtendedOptions map[string]string `json:"extendedOptions,omitempty"`
+}
+
+// DisruptionBudget configures the PodDisruptionBudget protecting the memcached pods.
+// At most one of MinAvailable and MaxUnavailable may be set.
+type DisruptionBudget struct {
+	// MinAvailable is the number or percentage of members that must stay available
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of members that may be unavailable
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// Autoscaling configures the HorizontalPodAutoscaler scaling the memcached cluster.
+// When no target is set the members are scaled to an average CPU utilization of
+// DefaultTargetCPUUtilizationPercentage.
+type Autoscaling struct {
+	// MinReplicas is the least number of members the autoscaler may scale down to, 1 when omitted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the largest number of members the autoscaler may scale up to
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization of the members,
+	// in percent of their requests, the autoscaler aims for
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the average memory utilization of the members,
+	// in percent of their requests, the autoscaler aims for
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+}
+
+// Probe configures how the operator probes the members over the memcached protocol.
+type Probe struct {
+	// PeriodSeconds is how often each member is probed, DefaultProbePeriodSeconds when omitted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds is how long a member has to answer, DefaultProbeTimeoutSeconds when omitted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// Auth configures how clients authenticate to the members.
+type Auth struct {
+	// SASL requires clients to authenticate with the credentials of a MemcachedUser referencing
+	// the Memcached. Memcached only supports SASL over the binary protocol, so the text protocol
+	// is disabled while it is enabled.
+	// +optional
+	SASL *SASLAuth `json:"sasl,omitempty"`
+}
+
+// SASLAuth configures SASL authentication with the PLAIN mechanism.
+type SASLAuth struct {
+	// Enabled requires clients to authenticate. Changing it, or the users, rolls the members.
+	Enabled bool `json:"enabled"`
+}
+
+// TLS configures the certificate the members serve TLS with. It is read from the Secret named by
+// SecretName, or issued by the operator from a CA it manages when SecretName is omitted.
+type TLS struct {
+	// Enabled serves the members over TLS only. Changing it rolls the members.
+	Enabled bool `json:"enabled"`
+
+	// SecretName names an existing Secret of type kubernetes.io/tls holding the certificate and key
+	// of the members. The operator verifies the members against the CA in its ca.crt key, or the
+	// system roots when it has none, for the <name>.<namespace>.svc name of the Service.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// CertificateDuration is how long the certificates issued by the operator are valid,
+	// DefaultCertificateDuration when omitted. They are renewed, rolling the members, once two
+	// thirds of it passed. The CA certificate is published in the <name>-ca-bundle ConfigMap.
+	// +optional
+	CertificateDuration *metav1.Duration `json:"certificateDuration,omitempty"`
+}
+
+// Access selects the client pods allowed to connect to the members. The operator is admitted as
+// well while it connects to the members, to probe them or to flush them on deletion, so the
+// statistics of the members are only collected then.
+type Access struct {
+	// PodSelector selects the client pods, every pod of the selected namespaces when omitted
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	// NamespaceSelector selects the namespaces of the client pods, the namespace of the Memcached when omitted
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// AntiAffinity is how strongly the members are kept off the nodes running other members
+// +kubebuilder:validation:Enum=soft;hard
+type AntiAffinity string
+
+const (
+	// AntiAffinitySoft prefers nodes not running another member, but schedules members together
+	// when no other node fits
+	AntiAffinitySoft AntiAffinity = "soft"
+	// AntiAffinityHard never schedules two members on the same node, leaving members pending
+	// when there are fewer fitting nodes than members
+	AntiAffinityHard AntiAffinity = "hard"
+)
+
+// Placement configures the scheduling of the memcached pods.
+type Placement struct {
+	// AntiAffinity keeps the members off the nodes running other members, soft or hard.
+	// Members may share nodes when it is omitted.
+	// +optional
+	AntiAffinity AntiAffinity `json:"antiAffinity,omitempty"`
+
+	// ZoneSpread spreads the members evenly across the topology.kubernetes.io/zone zones of the nodes
+	// +optional
+	ZoneSpread *TopologySpread `json:"zoneSpread,omitempty"`
+
+	// HostSpread spreads the members evenly across the nodes
+	// +optional
+	HostSpread *TopologySpread `json:"hostSpread,omitempty"`
+
+	// NodeSelector restricts the members to the nodes with all of the given labels
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations let the members be scheduled on nodes with matching taints
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// PriorityClassName is the PriorityClass of the memcached pods
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// TopologySpread configures a topology spread constraint of the members. It requires the
+// EvenPodsSpread feature gate on clusters older than Kubernetes 1.18.
+type TopologySpread struct {
+	// MaxSkew is the most the number of members may differ between two domains, 1 when omitted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+
+	// WhenUnsatisfiable is what the scheduler does with a member it cannot place without
+	// exceeding MaxSkew, DoNotSchedule or ScheduleAnyway. ScheduleAnyway when omitted.
+	// +kubebuilder:validation:Enum=DoNotSchedule;ScheduleAnyway
+	// +optional
+	WhenUnsatisfiable corev1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
 }
 
 // MemcachedStatus defines the observed state of Memcached
@@ -39,12 +409,137 @@ type MemcachedStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	// Nodes are the names of the memcached pods
 	Nodes []string `json:"nodes"`
+
+	// Members describe each memcached pod, ordered by name
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Members []MemberStatus `json:"members,omitempty"`
+
+	// Zones count the scheduled members of each zone, ordered by zone
+	// +optional
+	// +listType=map
+	// +listMapKey=zone
+	Zones []ZoneStatus `json:"zones,omitempty"`
+
+	// CurrentVersion is the memcached version every member has been rolled out with
+	// +optional
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// TargetVersion is the memcached version the members are being rolled out to
+	// +optional
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// ActiveUsers are the SASL usernames the members accept, sorted. Users are only active
+	// once every member has been rolled out with them.
+	// +optional
+	// +listType=set
+	ActiveUsers []string `json:"activeUsers,omitempty"`
+
+	// Conditions represent the latest available observations of the memcached cluster
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the most recent .metadata.generation the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Replicas is the number of memcached pods managed by the operator
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of memcached pods that are ready
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Selector is the label selector of the memcached pods, used by the scale subresource
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// LastRestartTime is the restartedAt of the last restart rolled out to every member
+	// +optional
+	LastRestartTime *metav1.Time `json:"lastRestartTime,omitempty"`
+
+	// ConnectionInfo references the ConfigMap, or the Secret when SASL is enabled, publishing how
+	// clients connect to the members
+	// +optional
+	ConnectionInfo *ConnectionInfoReference `json:"connectionInfo,omitempty"`
+}
+
+// ConnectionInfoReference references the object publishing how clients connect to the members. Its
+// address key holds the host:port of the Service, its members key the host:port of each ready
+// member ordered by name and separated by commas, its protocol key the protocol clients speak,
+// ascii or binary when SASL is enabled, and its tls key whether the members serve TLS only. With
+// TLS, its serverName key holds the name the certificate is verified for and its ca.crt key the
+// CA bundle to verify it with, when known.
+type ConnectionInfoReference struct {
+	// Kind is the kind of the object, ConfigMap or Secret
+	Kind string `json:"kind"`
+
+	// Name is the name of the object, in the namespace of the Memcached
+	Name string `json:"name"`
+}
+
+// ZoneStatus counts the members scheduled in one zone
+type ZoneStatus struct {
+	// Zone is the topology zone of the nodes
+	Zone string `json:"zone"`
+
+	// Members is the number of members running on the nodes of the zone
+	Members int32 `json:"members"`
+}
+
+// MemberStatus describes the observed state of one memcached pod
+type MemberStatus struct {
+	// Name is the name of the pod
+	Name string `json:"name"`
+
+	// PodIP is the IP address the member serves on
+	// +optional
+	PodIP string `json:"podIP,omitempty"`
+
+	// NodeName is the node the pod is scheduled on
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// Zone is the topology zone of the node the pod runs on
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Ready tells whether the pod passes its readiness checks
+	Ready bool `json:"ready"`
+
+	// RestartCount is the number of times the memcached container has been restarted
+	RestartCount int32 `json:"restartCount"`
+
+	// LastTerminationReason is the reason the memcached container last terminated, e.g. OOMKilled
+	// +optional
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+
+	// Reachable tells whether the member answered the last memcached probe, unset when it was not probed
+	// +optional
+	Reachable *bool `json:"reachable,omitempty"`
+
+	// Version is the memcached version the member reported
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// UptimeSeconds is the memcached uptime the member reported
+	// +optional
+	UptimeSeconds int64 `json:"uptimeSeconds,omitempty"`
+
+	// LastProbeTime is the last time the member was probed
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 
 // Memcached is the Schema for the memcacheds API
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.replicas,selectorpath=.status.selector
 type Memcached struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -62,6 +557,135 @@ type MemcachedList struct {
 	Items           []Memcached `json:"items"`
 }
 
+// CacheMemoryMB returns the cache size in megabytes memcached is started with.
+func (s *MemcachedSpec) CacheMemoryMB() int64 {
+	if s.Memory == nil {
+		return DefaultMemoryMB
+	}
+	return s.Memory.Value() / (1024 * 1024)
+}
+
+// IsPaused reports whether the PausedAnnotation is set on the Memcached.
+func (m *Memcached) IsPaused() bool {
+	_, ok := m.Annotations[PausedAnnotation]
+	return ok
+}
+
+// SASLEnabled reports whether clients must authenticate with SASL.
+func (s *MemcachedSpec) SASLEnabled() bool {
+	return s.Auth != nil && s.Auth.SASL != nil && s.Auth.SASL.Enabled
+}
+
+// TLSEnabled reports whether the members serve TLS only.
+func (s *MemcachedSpec) TLSEnabled() bool {
+	return s.TLS != nil && s.TLS.Enabled
+}
+
+// IsReservedOption reports whether the extended option key is set by a Config field or by the
+// operator, so Config.ExtendedOptions cannot override it.
+func IsReservedOption(key string) bool {
+	switch key {
+	case "modern", "lru_crawler", "no_lru_crawler", "lru_maintainer", "no_lru_maintainer", "hot_lru_pct", "warm_lru_pct",
+		"slab_automove", "slab_automove_window", "ssl_chain_cert", "ssl_key":
+		return true
+	}
+	return false
+}
+
+// ConfigErrors returns the problems of the memcached configuration of the spec, which memcached
+// would refuse to start with.
+func (s *MemcachedSpec) ConfigErrors() []string {
+	c := s.Config
+	if c == nil {
+		return nil
+	}
+	var errs []string
+	if c.MaxItemSize != nil {
+		size := c.MaxItemSize.Value()
+		if size < MinMaxItemSize || size > MaxMaxItemSize {
+			errs = append(errs, fmt.Sprintf("Max item size %s must be between 1Ki and 1Gi", c.MaxItemSize.String()))
+		} else if cacheMB := s.CacheMemoryMB(); size > cacheMB*1024*1024/2 {
+			errs = append(errs, fmt.Sprintf("Max item size %s must be at most half of the %dMi cache", c.MaxItemSize.String(), cacheMB))
+		}
+	}
+	lruCrawler := c.LRUCrawler == nil || *c.LRUCrawler
+	lruMaintainer := c.LRUMaintainer == nil || *c.LRUMaintainer
+	if (!lruCrawler || !lruMaintainer) && !VersionAtLeast(s.Version, MinNoModernOptionsVersion) {
+		errs = append(errs, fmt.Sprintf("Disabling the LRU crawler or maintainer requires memcached %s or later", MinNoModernOptionsVersion))
+	}
+	if !lruMaintainer && (c.HotLRUPercent != nil || c.WarmLRUPercent != nil) {
+		errs = append(errs, "Hot and warm LRU percentages require the LRU maintainer")
+	}
+	if c.HotLRUPercent != nil && c.WarmLRUPercent != nil && *c.HotLRUPercent+*c.WarmLRUPercent > MaxLRUPercent {
+		errs = append(errs, fmt.Sprintf("Hot and warm LRUs may take at most %d%% of the memory together, not %d%%",
+			MaxLRUPercent, *c.HotLRUPercent+*c.WarmLRUPercent))
+	}
+	if c.SlabAutomoveWindow != nil && c.SlabAutomove != nil && *c.SlabAutomove == 0 {
+		errs = append(errs, "Slab automove window requires the slab automover")
+	}
+	keys := make([]string, 0, len(c.ExtendedOptions))
+	for key := range c.ExtendedOptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch {
+		case key == "" || strings.ContainsAny(key, ",= "):
+			errs = append(errs, fmt.Sprintf("Extended option %q is not a valid option name", key))
+		case IsReservedOption(key):
+			errs = append(errs, fmt.Sprintf("Extended option %s is set by the operator or by another config field", key))
+		case strings.Contains(c.ExtendedOptions[key], ","):
+			errs = append(errs, fmt.Sprintf("Extended option %s value must not contain a comma", key))
+		}
+	}
+	return errs
+}
+
+// VersionAtLeast reports whether the memcached image tag v, e.g. "1.5.20-alpine", is at least the
+// version min. An empty tag stands for DefaultVersion. Tags that are not a version, e.g. "latest",
+// are assumed to be recent enough.
+func VersionAtLeast(v, min string) bool {
+	if v == "" {
+		v = DefaultVersion
+	}
+	have, ok := parseVersion(v)
+	if !ok {
+		return true
+	}
+	want, _ := parseVersion(min)
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i]
+		}
+	}
+	return true
+}
+
+// parseVersion returns the major, minor and patch numbers of a memcached image tag.
+// Missing minor and patch numbers are zero.
+func parseVersion(v string) ([3]int, bool) {
+	var version [3]int
+	v = strings.SplitN(v, "-", 2)[0]
+	for i, part := range strings.SplitN(v, ".", 3) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return version, false
+		}
+		version[i] = n
+	}
+	return version, true
+}
+
+// MemoryOverheadMB returns the memory in megabytes reserved on top of a cache of
+// the given size for connection buffers and slab fragmentation.
+func MemoryOverheadMB(cacheMB int64) int64 {
+	overhead := cacheMB / 4
+	if overhead < MinMemoryOverheadMB {
+		overhead = MinMemoryOverheadMB
+	}
+	return overhead
+}
+
 func init() {
 	SchemeBuilder.Register(&Memcached{}, &MemcachedList{})
 }
@@ -17,10 +17,24 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -28,7 +42,19 @@ import (
 // log is for logging in this package.
 var memcachedlog = logf.Log.WithName("memcached-resource")
 
+// RolloutAckAnnotation acknowledges an update restarting every member, which loses the data they
+// cache. It must be set to a new value, e.g. a date or a change ticket, by the update it acknowledges.
+const RolloutAckAnnotation = "cache.example.com/rollout-ack"
+
+// MaxScaleDownStep is the most members a single update may remove, so a typo cannot drop most
+// of the cache at once. Zero lets an update remove any number of members.
+var MaxScaleDownStep int32 = 2
+
+// policyReader reads the MemcachedPolicies and Namespaces evaluated by the validating webhook
+var policyReader client.Reader
+
 func (r *Memcached) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	policyReader = mgr.GetClient()
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -44,6 +70,24 @@ func (r *Memcached) Default() {
 
 	if r.Spec.Size == 0 {
 		r.Spec.Size = 3
+		if r.Spec.Autoscaling != nil {
+			r.Spec.Size = 1
+			if r.Spec.Autoscaling.MinReplicas != nil {
+				r.Spec.Size = *r.Spec.Autoscaling.MinReplicas
+			}
+		}
+	}
+	if r.Spec.Image == "" {
+		r.Spec.Image = DefaultImage
+	}
+	if r.Spec.Version == "" {
+		r.Spec.Version = DefaultVersion
+	}
+	if r.Spec.WorkloadType == "" {
+		r.Spec.WorkloadType = WorkloadTypeDeployment
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
 	}
 }
 
@@ -55,14 +99,75 @@ var _ webhook.Validator = &Memcached{}
 func (r *Memcached) ValidateCreate() error {
 	memcachedlog.Info("validate create", "name", r.Name)
 
-	return validateOdd(r.Spec.Size)
+	if err := validateSize(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateDisruptionBudget(r.Spec.DisruptionBudget); err != nil {
+		return err
+	}
+	if err := validateMemory(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateConfig(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateTLS(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateAccess(r.Spec.Access); err != nil {
+		return err
+	}
+	if err := validatePlacement(r.Spec.Placement); err != nil {
+		return err
+	}
+	return validatePolicies(r)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Memcached) ValidateUpdate(old runtime.Object) error {
 	memcachedlog.Info("validate update", "name", r.Name)
 
-	return validateOdd(r.Spec.Size)
+	if err := validateSize(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateDisruptionBudget(r.Spec.DisruptionBudget); err != nil {
+		return err
+	}
+	if err := validateMemory(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateConfig(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateTLS(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateAccess(r.Spec.Access); err != nil {
+		return err
+	}
+	if err := validatePlacement(r.Spec.Placement); err != nil {
+		return err
+	}
+
+	oldMemcached := old.(*Memcached)
+	if err := validateImmutableFields(oldMemcached, r); err != nil {
+		return err
+	}
+	if err := validateVersionChange(oldMemcached.Spec.Version, r.Spec.Version); err != nil {
+		return err
+	}
+	if err := validateScaleDown(oldMemcached.Spec.Size, r.Spec.Size); err != nil {
+		return err
+	}
+	if err := validateRollout(oldMemcached, r); err != nil {
+		return err
+	}
+	// Memcacheds violating a policy created after them are reported by the policy controller
+	// instead, so they can still be released or have their metadata updated
+	if equality.Semantic.DeepEqual(oldMemcached.Spec, r.Spec) && equality.Semantic.DeepEqual(oldMemcached.Labels, r.Labels) {
+		return nil
+	}
+	return validatePolicies(r)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -72,9 +177,267 @@ func (r *Memcached) ValidateDelete() error {
 	return nil
 }
 
+// validateSize requires an odd cluster size, unless the size is chosen by the autoscaler
+// through the scale subresource, in which case the autoscaling bounds are checked instead.
+func validateSize(spec *MemcachedSpec) error {
+	if spec.Autoscaling == nil {
+		return validateOdd(spec.Size)
+	}
+	return validateAutoscaling(spec.Autoscaling)
+}
+
 func validateOdd(n int32) error {
 	if n%2 == 0 {
 		return errors.New("Cluster size must be an odd number")
 	}
 	return nil
 }
+
+// validateAutoscaling rejects autoscaling bounds the autoscaler cannot satisfy.
+func validateAutoscaling(autoscaling *Autoscaling) error {
+	if autoscaling.MaxReplicas < 1 {
+		return errors.New("Autoscaling maxReplicas must be at least 1")
+	}
+	if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+		return fmt.Errorf("Autoscaling minReplicas %d must not exceed maxReplicas %d", *autoscaling.MinReplicas, autoscaling.MaxReplicas)
+	}
+	return nil
+}
+
+// validateDisruptionBudget rejects a disruption budget setting both bounds, or a bound that
+// is negative or not a valid percentage.
+func validateDisruptionBudget(budget *DisruptionBudget) error {
+	if budget == nil {
+		return nil
+	}
+	if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+		return errors.New("Only one of minAvailable and maxUnavailable may be set in the disruption budget")
+	}
+	for field, value := range map[string]*intstr.IntOrString{"minAvailable": budget.MinAvailable, "maxUnavailable": budget.MaxUnavailable} {
+		if value == nil {
+			continue
+		}
+		n, err := intstr.GetValueFromIntOrPercent(value, 100, true)
+		if err != nil {
+			return fmt.Errorf("Disruption budget %s %s is not a number or percentage", field, value.String())
+		}
+		if n < 0 {
+			return fmt.Errorf("Disruption budget %s %s must not be negative", field, value.String())
+		}
+	}
+	return nil
+}
+
+// validateMemory rejects a cache that does not fit inside the container memory limit
+// once connection and slab overhead is accounted for.
+func validateMemory(spec *MemcachedSpec) error {
+	cacheMB := spec.CacheMemoryMB()
+	if cacheMB < 1 {
+		return errors.New("Cache memory must be at least 1Mi")
+	}
+	if spec.Resources == nil {
+		return nil
+	}
+	limit, ok := spec.Resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return nil
+	}
+	overheadMB := MemoryOverheadMB(cacheMB)
+	if limit.Value() < (cacheMB+overheadMB)*1024*1024 {
+		return fmt.Errorf("Memory limit %s cannot fit a %dMi cache plus %dMi of overhead", limit.String(), cacheMB, overheadMB)
+	}
+	return nil
+}
+
+// validateConfig rejects memcached configurations memcached would refuse to start with.
+func validateConfig(spec *MemcachedSpec) error {
+	if errs := spec.ConfigErrors(); len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateTLS rejects TLS on a memcached version that cannot serve it, and certificates issued
+// by the operator for less than MinCertificateDuration.
+func validateTLS(spec *MemcachedSpec) error {
+	if !spec.TLSEnabled() {
+		return nil
+	}
+	if !VersionAtLeast(spec.Version, MinTLSVersion) {
+		return fmt.Errorf("TLS requires memcached %s or later, version %s cannot serve it", MinTLSVersion, spec.Version)
+	}
+	if d := spec.TLS.CertificateDuration; d != nil && d.Duration < MinCertificateDuration {
+		return fmt.Errorf("Certificate duration %s must be at least %s", d.Duration, MinCertificateDuration)
+	}
+	return nil
+}
+
+// validateAccess rejects access selectors the NetworkPolicy admitting the clients cannot use.
+func validateAccess(access *Access) error {
+	if access == nil {
+		return nil
+	}
+	for field, selector := range map[string]*metav1.LabelSelector{"podSelector": access.PodSelector, "namespaceSelector": access.NamespaceSelector} {
+		if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			return fmt.Errorf("Access %s is invalid: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// validatePlacement rejects tolerations the memcached pods would be refused with.
+func validatePlacement(placement *Placement) error {
+	if placement == nil {
+		return nil
+	}
+	for i, toleration := range placement.Tolerations {
+		if toleration.Key == "" && toleration.Operator != corev1.TolerationOpExists {
+			return fmt.Errorf("Placement toleration %d without a key must use the Exists operator", i)
+		}
+		if toleration.Operator == corev1.TolerationOpExists && toleration.Value != "" {
+			return fmt.Errorf("Placement toleration %d with the Exists operator must not have a value", i)
+		}
+		if toleration.TolerationSeconds != nil && toleration.Effect != corev1.TaintEffectNoExecute {
+			return fmt.Errorf("Placement toleration %d may only set tolerationSeconds with the NoExecute effect", i)
+		}
+	}
+	return nil
+}
+
+// validateImmutableFields rejects changes to the fields that cannot change in place. The workload
+// type is the kind of the object running the members, which cannot be converted to the other kind.
+// The whole spec of a Memcached being deleted is frozen, as its teardown already runs against it.
+func validateImmutableFields(old, updated *Memcached) error {
+	var errs field.ErrorList
+	// An unset workload type is defaulted to a Deployment
+	if (old.Spec.WorkloadType == WorkloadTypeStatefulSet) != (updated.Spec.WorkloadType == WorkloadTypeStatefulSet) {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "workloadType"),
+			"may not change once set, create a new Memcached to run the members in a "+string(updated.Spec.WorkloadType)))
+	}
+	if old.DeletionTimestamp != nil {
+		oldSpec, updatedSpec := reflect.ValueOf(old.Spec), reflect.ValueOf(updated.Spec)
+		for i := 0; i < oldSpec.NumField(); i++ {
+			name := strings.Split(oldSpec.Type().Field(i).Tag.Get("json"), ",")[0]
+			if name == "workloadType" || equality.Semantic.DeepEqual(oldSpec.Field(i).Interface(), updatedSpec.Field(i).Interface()) {
+				continue
+			}
+			errs = append(errs, field.Forbidden(field.NewPath("spec", name), "may not change while the Memcached is being deleted"))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Memcached"}, updated.Name, errs)
+}
+
+// validateScaleDown rejects removing more than MaxScaleDownStep members in a single update.
+func validateScaleDown(oldSize, newSize int32) error {
+	if MaxScaleDownStep > 0 && oldSize-newSize > MaxScaleDownStep {
+		return fmt.Errorf("Scaling down from %d to %d members would drop the data of %d members at once, "+
+			"scale down by at most %d members per update", oldSize, newSize, oldSize-newSize, MaxScaleDownStep)
+	}
+	return nil
+}
+
+// validateRollout rejects a change restarting every member unless the update acknowledges it
+// by setting RolloutAckAnnotation to a new value.
+func validateRollout(old, updated *Memcached) error {
+	fields := rolloutFields(&old.Spec, &updated.Spec)
+	if len(fields) == 0 {
+		return nil
+	}
+	if ack, ok := updated.Annotations[RolloutAckAnnotation]; ok && ack != old.Annotations[RolloutAckAnnotation] {
+		return nil
+	}
+	return fmt.Errorf("Changing %s restarts every member, dropping all the cached data. "+
+		"Set the %s annotation to a new value in the same update to acknowledge it", strings.Join(fields, ", "), RolloutAckAnnotation)
+}
+
+// rolloutFields returns the fields changed between the given specs that restart every member.
+func rolloutFields(old, updated *MemcachedSpec) []string {
+	var fields []string
+	if old.Image != updated.Image {
+		fields = append(fields, "image")
+	}
+	if old.Version != updated.Version {
+		fields = append(fields, "version")
+	}
+	if old.CacheMemoryMB() != updated.CacheMemoryMB() {
+		fields = append(fields, "memory")
+	}
+	if !equality.Semantic.DeepEqual(old.Resources, updated.Resources) {
+		fields = append(fields, "resources")
+	}
+	if !equality.Semantic.DeepEqual(old.Config, updated.Config) {
+		fields = append(fields, "config")
+	}
+	if old.SASLEnabled() != updated.SASLEnabled() {
+		fields = append(fields, "auth.sasl.enabled")
+	}
+	if old.TLSEnabled() != updated.TLSEnabled() || (updated.TLSEnabled() && old.TLS.SecretName != updated.TLS.SecretName) {
+		fields = append(fields, "tls")
+	}
+	if !equality.Semantic.DeepEqual(old.Placement, updated.Placement) {
+		fields = append(fields, "placement")
+	}
+	return fields
+}
+
+// validatePolicies evaluates every MemcachedPolicy selecting the namespace of the given Memcached,
+// returning the violations of all of them as a single error.
+func validatePolicies(m *Memcached) error {
+	ctx := context.Background()
+	ns := &corev1.Namespace{}
+	if err := policyReader.Get(ctx, types.NamespacedName{Name: m.Namespace}, ns); err != nil {
+		return err
+	}
+	policies := &MemcachedPolicyList{}
+	if err := policyReader.List(ctx, policies); err != nil {
+		return err
+	}
+	var errs field.ErrorList
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		selected, err := policy.Selects(ns)
+		if err != nil {
+			return fmt.Errorf("MemcachedPolicy %s has an invalid namespace selector: %v", policy.Name, err)
+		}
+		if selected {
+			errs = append(errs, policy.Violations(m)...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Memcached"}, m.Name, errs)
+}
+
+// validateVersionChange rejects moving to an older major memcached version.
+// Versions whose major number cannot be parsed (e.g. "latest") are not checked.
+func validateVersionChange(oldVersion, newVersion string) error {
+	oldMajor, ok := majorVersion(oldVersion)
+	if !ok {
+		return nil
+	}
+	newMajor, ok := majorVersion(newVersion)
+	if !ok {
+		return nil
+	}
+	if newMajor < oldMajor {
+		return fmt.Errorf("Downgrading memcached from major version %d to %d is not supported", oldMajor, newMajor)
+	}
+	return nil
+}
+
+// majorVersion returns the major number of a memcached image tag such as
+// "1.5.20-alpine". An empty tag stands for DefaultVersion.
+func majorVersion(v string) (int, bool) {
+	if v == "" {
+		v = DefaultVersion
+	}
+	major, err := strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+	if err != nil {
+		return 0, false
+	}
+	return major, true
+}
@@ -0,0 +1,503 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// validMemcached returns a defaulted Memcached passing the create validation.
+func validMemcached() *Memcached {
+	m := &Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-sample", Namespace: "default"},
+		Spec:       MemcachedSpec{Size: 5},
+	}
+	m.Default()
+	return m
+}
+
+// usePolicies makes the webhook evaluate the given policies for Memcacheds of the "default"
+// namespace, labelled env=prod. It returns a function restoring the previous policy reader.
+func usePolicies(policies ...*MemcachedPolicy) func() {
+	scheme := runtime.NewScheme()
+	_ = AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	objs := []runtime.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "prod"}}}}
+	for _, p := range policies {
+		objs = append(objs, p)
+	}
+	previous := policyReader
+	policyReader = fake.NewFakeClientWithScheme(scheme, objs...)
+	return func() { policyReader = previous }
+}
+
+func TestValidateUpdate(t *testing.T) {
+	defer usePolicies()()
+	now := metav1.Now()
+	memory := resource.MustParse("128Mi")
+	four, disabled := int32(4), false
+
+	tests := []struct {
+		name string
+		// update changes the copy of a valid Memcached used as the new object
+		update func(m *Memcached)
+		// old changes the valid Memcached used as the old object
+		old func(m *Memcached)
+		// err is a substring of the expected error, empty when the update is allowed
+		err string
+	}{
+		{
+			name:   "unchanged spec",
+			update: func(m *Memcached) {},
+		},
+		{
+			name:   "spec change while deleting",
+			old:    func(m *Memcached) { m.DeletionTimestamp = &now },
+			update: func(m *Memcached) { m.DeletionTimestamp = &now; m.Spec.DeletionPolicy = DeletionPolicyFlush },
+			err:    "spec.deletionPolicy: Forbidden",
+		},
+		{
+			name:   "workload type change while deleting",
+			old:    func(m *Memcached) { m.DeletionTimestamp = &now },
+			update: func(m *Memcached) { m.DeletionTimestamp = &now; m.Spec.WorkloadType = WorkloadTypeStatefulSet },
+			err:    "spec.workloadType: Forbidden: may not change once set",
+		},
+		{
+			name:   "finalizer removal while deleting",
+			old:    func(m *Memcached) { m.DeletionTimestamp = &now; m.Finalizers = []string{"cache.example.com/teardown"} },
+			update: func(m *Memcached) { m.DeletionTimestamp = &now; m.Finalizers = nil },
+		},
+		{
+			name:   "scale up",
+			update: func(m *Memcached) { m.Spec.Size = 9 },
+		},
+		{
+			name:   "scale down by the step",
+			update: func(m *Memcached) { m.Spec.Size = 3 },
+		},
+		{
+			name:   "scale down beyond the step",
+			update: func(m *Memcached) { m.Spec.Size = 1 },
+			err:    "scale down by at most 2 members per update",
+		},
+		{
+			name:   "version upgrade without acknowledgment",
+			update: func(m *Memcached) { m.Spec.Version = "1.5.20-alpine" },
+			err:    "Changing version restarts every member",
+		},
+		{
+			name: "version upgrade with acknowledgment",
+			update: func(m *Memcached) {
+				m.Spec.Version = "1.5.20-alpine"
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+		},
+		{
+			name: "version upgrade with a previous acknowledgment",
+			old:  func(m *Memcached) { m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"} },
+			update: func(m *Memcached) {
+				m.Spec.Version = "1.5.20-alpine"
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Changing version restarts every member",
+		},
+		{
+			name:   "memory change without acknowledgment",
+			update: func(m *Memcached) { m.Spec.Memory = &memory },
+			err:    "Changing memory restarts every member",
+		},
+		{
+			name:   "explicit default memory",
+			update: func(m *Memcached) { q := resource.MustParse("64Mi"); m.Spec.Memory = &q },
+		},
+		{
+			name: "image and resources change without acknowledgment",
+			update: func(m *Memcached) {
+				m.Spec.Image = "example.com/memcached"
+				m.Spec.Resources = &corev1.ResourceRequirements{}
+			},
+			err: "Changing image, resources restarts every member",
+		},
+		{
+			name:   "workload type change",
+			update: func(m *Memcached) { m.Spec.WorkloadType = WorkloadTypeStatefulSet },
+			err:    "spec.workloadType: Forbidden: may not change once set",
+		},
+		{
+			name: "workload type change with acknowledgment",
+			update: func(m *Memcached) {
+				m.Spec.WorkloadType = WorkloadTypeStatefulSet
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "spec.workloadType: Forbidden: may not change once set",
+		},
+		{
+			name:   "workload type back to a Deployment",
+			old:    func(m *Memcached) { m.Spec.WorkloadType = WorkloadTypeStatefulSet },
+			update: func(m *Memcached) { m.Spec.WorkloadType = WorkloadTypeDeployment },
+			err:    "spec.workloadType: Forbidden: may not change once set",
+		},
+		{
+			name:   "explicit default workload type",
+			update: func(m *Memcached) { m.Spec.WorkloadType = WorkloadTypeDeployment },
+		},
+		{
+			name:   "enabling SASL without acknowledgment",
+			update: func(m *Memcached) { m.Spec.Auth = &Auth{SASL: &SASLAuth{Enabled: true}} },
+			err:    "Changing auth.sasl.enabled restarts every member",
+		},
+		{
+			name:   "enabling TLS without acknowledgment",
+			old:    func(m *Memcached) { m.Spec.Version = "1.6.9" },
+			update: func(m *Memcached) { m.Spec.TLS = &TLS{Enabled: true} },
+			err:    "Changing tls restarts every member",
+		},
+		{
+			name: "enabling TLS with acknowledgment",
+			old:  func(m *Memcached) { m.Spec.Version = "1.6.9" },
+			update: func(m *Memcached) {
+				m.Spec.TLS = &TLS{Enabled: true}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+		},
+		{
+			name: "enabling TLS on a version without TLS support",
+			update: func(m *Memcached) {
+				m.Spec.TLS = &TLS{Enabled: true}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "TLS requires memcached 1.5.13 or later",
+		},
+		{
+			name: "certificate duration below the minimum",
+			old:  func(m *Memcached) { m.Spec.Version = "1.6.9"; m.Spec.TLS = &TLS{Enabled: true} },
+			update: func(m *Memcached) {
+				m.Spec.TLS.CertificateDuration = &metav1.Duration{Duration: time.Minute}
+			},
+			err: "Certificate duration 1m0s must be at least 1h0m0s",
+		},
+		{
+			name: "invalid access selector",
+			update: func(m *Memcached) {
+				m.Spec.Access = &Access{PodSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpIn}},
+				}}
+			},
+			err: "Access podSelector is invalid",
+		},
+		{
+			name:   "changing config without acknowledgment",
+			update: func(m *Memcached) { m.Spec.Config = &Config{Threads: &four} },
+			err:    "Changing config restarts every member",
+		},
+		{
+			name: "max item size above half of the cache",
+			update: func(m *Memcached) {
+				size := resource.MustParse("48Mi")
+				m.Spec.Config = &Config{MaxItemSize: &size}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Max item size 48Mi must be at most half of the 64Mi cache",
+		},
+		{
+			name: "max item size below 1Ki",
+			update: func(m *Memcached) {
+				size := resource.MustParse("512")
+				m.Spec.Config = &Config{MaxItemSize: &size}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Max item size 512 must be between 1Ki and 1Gi",
+		},
+		{
+			name: "disabling the LRU crawler on a version without no_ options",
+			update: func(m *Memcached) {
+				m.Spec.Config = &Config{LRUCrawler: &disabled}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Disabling the LRU crawler or maintainer requires memcached 1.5.0 or later",
+		},
+		{
+			name: "LRU percentages without the LRU maintainer",
+			old:  func(m *Memcached) { m.Spec.Version = "1.6.9" },
+			update: func(m *Memcached) {
+				m.Spec.Config = &Config{LRUMaintainer: &disabled, HotLRUPercent: &four}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Hot and warm LRU percentages require the LRU maintainer",
+		},
+		{
+			name: "hot and warm LRUs above 80 percent",
+			update: func(m *Memcached) {
+				hot, warm := int32(40), int32(50)
+				m.Spec.Config = &Config{HotLRUPercent: &hot, WarmLRUPercent: &warm}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Hot and warm LRUs may take at most 80% of the memory together, not 90%",
+		},
+		{
+			name: "slab automove window without the slab automover",
+			update: func(m *Memcached) {
+				never := int32(0)
+				m.Spec.Config = &Config{SlabAutomove: &never, SlabAutomoveWindow: &four}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Slab automove window requires the slab automover",
+		},
+		{
+			name: "extended option set by the operator",
+			update: func(m *Memcached) {
+				m.Spec.Config = &Config{ExtendedOptions: map[string]string{"ssl_key": "/tmp/key"}}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Extended option ssl_key is set by the operator or by another config field",
+		},
+		{
+			name: "extended option with an invalid name",
+			update: func(m *Memcached) {
+				m.Spec.Config = &Config{ExtendedOptions: map[string]string{"a,b": ""}}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: `Extended option "a,b" is not a valid option name`,
+		},
+		{
+			name: "valid config with acknowledgment",
+			old:  func(m *Memcached) { m.Spec.Version = "1.6.9" },
+			update: func(m *Memcached) {
+				size := resource.MustParse("2Mi")
+				m.Spec.Config = &Config{Threads: &four, MaxItemSize: &size, LRUCrawler: &disabled,
+					ExtendedOptions: map[string]string{"no_hashexpand": ""}}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+		},
+		{
+			name: "changing placement without acknowledgment",
+			update: func(m *Memcached) {
+				m.Spec.Placement = &Placement{AntiAffinity: AntiAffinityHard}
+			},
+			err: "Changing placement restarts every member",
+		},
+		{
+			name: "toleration seconds without the NoExecute effect",
+			update: func(m *Memcached) {
+				seconds := int64(60)
+				m.Spec.Placement = &Placement{Tolerations: []corev1.Toleration{{
+					Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "cache", Effect: corev1.TaintEffectNoSchedule, TolerationSeconds: &seconds,
+				}}}
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Placement toleration 0 may only set tolerationSeconds with the NoExecute effect",
+		},
+		{
+			name: "major version downgrade with acknowledgment",
+			old:  func(m *Memcached) { m.Spec.Version = "2.0.0" },
+			update: func(m *Memcached) {
+				m.Spec.Version = "1.6.9"
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Downgrading memcached from major version 2 to 1 is not supported",
+		},
+		{
+			name: "version downgrade with acknowledgment",
+			update: func(m *Memcached) {
+				m.Spec.Version = "0.9"
+				m.Annotations = map[string]string{RolloutAckAnnotation: "2020-04-01"}
+			},
+			err: "Downgrading memcached",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := validMemcached()
+			if tt.old != nil {
+				tt.old(old)
+			}
+			updated := old.DeepCopy()
+			tt.update(updated)
+
+			err := updated.ValidateUpdate(old)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("update was rejected: (%v)", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("update was allowed, expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("error %q does not contain %q", err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	maxSize := int32(3)
+	maxMemory := resource.MustParse("1Gi")
+	bigMemory := resource.MustParse("2Gi")
+	limits := &MemcachedPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: MemcachedPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			MaxSize:           &maxSize,
+			MaxMemory:         &maxMemory,
+		},
+	}
+	images := &MemcachedPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "images"},
+		Spec: MemcachedPolicySpec{
+			AllowedImages:  []string{DefaultImage, "registry.example.com/memcached"},
+			RequiredLabels: []string{"team"},
+		},
+	}
+	staging := &MemcachedPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "staging"},
+		Spec: MemcachedPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+			MaxSize:           &maxSize,
+		},
+	}
+	defer usePolicies(limits, images, staging)()
+
+	tests := []struct {
+		name   string
+		update func(m *Memcached)
+		// errs are substrings of the expected error, one per violated field
+		errs []string
+	}{
+		{
+			name:   "compliant",
+			update: func(m *Memcached) { m.Spec.Size = 3 },
+		},
+		{
+			name:   "size above the maximum",
+			update: func(m *Memcached) {},
+			errs:   []string{"spec.size: Invalid value: 5: exceeds the maximum size 3 of MemcachedPolicy limits"},
+		},
+		{
+			name: "autoscaling above the maximum",
+			update: func(m *Memcached) {
+				m.Spec.Size = 1
+				m.Spec.Autoscaling = &Autoscaling{MaxReplicas: 9}
+			},
+			errs: []string{"spec.autoscaling.maxReplicas: Invalid value: 9"},
+		},
+		{
+			name: "every rule violated",
+			update: func(m *Memcached) {
+				m.Spec.Memory = &bigMemory
+				m.Spec.Image = "example.com/memcached"
+				m.Labels = nil
+			},
+			errs: []string{
+				"spec.size: Invalid value: 5",
+				`spec.memory: Invalid value: "2048Mi": exceeds the maximum memory 1Gi of MemcachedPolicy limits`,
+				`spec.image: Invalid value: "example.com/memcached": is not one of the images allowed by MemcachedPolicy images`,
+				"metadata.labels[team]: Required value: required by MemcachedPolicy images",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := validMemcached()
+			m.Labels = map[string]string{"team": "web"}
+			tt.update(m)
+
+			err := m.ValidateCreate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("create was rejected: (%v)", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("create was allowed, expected errors %v", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+			if strings.Contains(err.Error(), "MemcachedPolicy staging") {
+				t.Errorf("error %q reports a policy not selecting the namespace", err.Error())
+			}
+		})
+	}
+
+	// An existing Memcached violating a policy can still be updated without changing its spec
+	old := validMemcached()
+	updated := old.DeepCopy()
+	updated.Finalizers = []string{"cache.example.com/teardown"}
+	if err := updated.ValidateUpdate(old); err != nil {
+		t.Errorf("metadata update of a violating Memcached was rejected: (%v)", err)
+	}
+	updated.Spec.Size = 7
+	if err := updated.ValidateUpdate(old); err == nil {
+		t.Error("spec update of a violating Memcached was allowed")
+	}
+}
+
+func TestValidateScaleDown(t *testing.T) {
+	defer func(step int32) { MaxScaleDownStep = step }(MaxScaleDownStep)
+
+	tests := []struct {
+		step             int32
+		oldSize, newSize int32
+		allowed          bool
+	}{
+		{step: 2, oldSize: 5, newSize: 3, allowed: true},
+		{step: 2, oldSize: 7, newSize: 3, allowed: false},
+		{step: 4, oldSize: 7, newSize: 3, allowed: true},
+		{step: 1, oldSize: 3, newSize: 1, allowed: false},
+		{step: 0, oldSize: 9, newSize: 1, allowed: true},
+		{step: 1, oldSize: 1, newSize: 9, allowed: true},
+	}
+	for _, tt := range tests {
+		MaxScaleDownStep = tt.step
+		err := validateScaleDown(tt.oldSize, tt.newSize)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("scaling from %d to %d with a step of %d: allowed is %t, expected %t (%v)", tt.oldSize, tt.newSize, tt.step, allowed, tt.allowed, err)
+		}
+	}
+}
+
+func TestValidateVersionChange(t *testing.T) {
+	tests := []struct {
+		oldVersion, newVersion string
+		allowed                bool
+	}{
+		{oldVersion: "2.0.0", newVersion: "1.6.9", allowed: false},
+		{oldVersion: "2.0.0", newVersion: "", allowed: false},
+		{oldVersion: "1.6.9", newVersion: "1.4.36", allowed: true},
+		{oldVersion: "1.6.9", newVersion: "2.0.0-alpine", allowed: true},
+		{oldVersion: "", newVersion: "1.4.36", allowed: true},
+		{oldVersion: "2.0.0", newVersion: "latest", allowed: true},
+		{oldVersion: "latest", newVersion: "1.4.36", allowed: true},
+	}
+	for _, tt := range tests {
+		err := validateVersionChange(tt.oldVersion, tt.newVersion)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("changing version from %q to %q: allowed is %t, expected %t (%v)", tt.oldVersion, tt.newVersion, allowed, tt.allowed, err)
+		}
+	}
+}
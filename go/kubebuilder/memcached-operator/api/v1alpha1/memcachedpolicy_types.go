@@ -0,0 +1,159 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// MemcachedPolicySpec defines the guardrails enforced on the Memcacheds of the selected namespaces
+type MemcachedPolicySpec struct {
+	// NamespaceSelector selects the namespaces whose Memcacheds the policy applies to.
+	// The policy applies to every namespace when it is omitted.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// MaxSize is the largest number of members a Memcached may have, or be autoscaled to
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+
+	// MaxMemory is the largest cache memory of a member of a Memcached
+	// +optional
+	MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+
+	// AllowedImages are the memcached images, without a tag, Memcacheds may run.
+	// Every image is allowed when it is empty.
+	// +optional
+	AllowedImages []string `json:"allowedImages,omitempty"`
+
+	// RequiredLabels are the label keys every Memcached must carry
+	// +optional
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+}
+
+// MemcachedPolicyStatus defines the observed state of MemcachedPolicy
+type MemcachedPolicyStatus struct {
+	// Violations are the existing Memcacheds violating the policy, ordered by namespace and name.
+	// Memcacheds created before the policy are not rejected until they are updated.
+	// +optional
+	Violations []PolicyViolation `json:"violations,omitempty"`
+
+	// ObservedGeneration is the most recent .metadata.generation the violations were computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// PolicyViolation describes a Memcached violating a MemcachedPolicy
+type PolicyViolation struct {
+	// Namespace is the namespace of the Memcached
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the Memcached
+	Name string `json:"name"`
+
+	// Messages describe each field of the Memcached violating the policy
+	Messages []string `json:"messages"`
+}
+
+// +kubebuilder:object:root=true
+
+// MemcachedPolicy is the Schema for the memcachedpolicies API. It limits the Memcacheds
+// created or updated in the namespaces it selects.
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Max Size",type=integer,JSONPath=`.spec.maxSize`
+// +kubebuilder:printcolumn:name="Max Memory",type=string,JSONPath=`.spec.maxMemory`
+type MemcachedPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MemcachedPolicySpec   `json:"spec,omitempty"`
+	Status MemcachedPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MemcachedPolicyList contains a list of MemcachedPolicy
+type MemcachedPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MemcachedPolicy `json:"items"`
+}
+
+// Selects reports whether the policy applies to the Memcacheds of the given namespace.
+func (p *MemcachedPolicy) Selects(ns *corev1.Namespace) (bool, error) {
+	if p.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// Violations returns an error for each field of the given Memcached violating the policy.
+func (p *MemcachedPolicy) Violations(m *Memcached) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if max := p.Spec.MaxSize; max != nil {
+		if m.Spec.Size > *max {
+			errs = append(errs, field.Invalid(specPath.Child("size"), m.Spec.Size,
+				fmt.Sprintf("exceeds the maximum size %d of MemcachedPolicy %s", *max, p.Name)))
+		}
+		if m.Spec.Autoscaling != nil && m.Spec.Autoscaling.MaxReplicas > *max {
+			errs = append(errs, field.Invalid(specPath.Child("autoscaling", "maxReplicas"), m.Spec.Autoscaling.MaxReplicas,
+				fmt.Sprintf("exceeds the maximum size %d of MemcachedPolicy %s", *max, p.Name)))
+		}
+	}
+	if max := p.Spec.MaxMemory; max != nil && m.Spec.CacheMemoryMB()*1024*1024 > max.Value() {
+		errs = append(errs, field.Invalid(specPath.Child("memory"), fmt.Sprintf("%dMi", m.Spec.CacheMemoryMB()),
+			fmt.Sprintf("exceeds the maximum memory %s of MemcachedPolicy %s", max.String(), p.Name)))
+	}
+	if len(p.Spec.AllowedImages) > 0 && !containsString(p.Spec.AllowedImages, m.Spec.Image) {
+		errs = append(errs, field.Invalid(specPath.Child("image"), m.Spec.Image,
+			fmt.Sprintf("is not one of the images allowed by MemcachedPolicy %s: %s", p.Name, strings.Join(p.Spec.AllowedImages, ", "))))
+	}
+	for _, key := range p.Spec.RequiredLabels {
+		if _, ok := m.Labels[key]; !ok {
+			errs = append(errs, field.Required(field.NewPath("metadata", "labels").Key(key),
+				fmt.Sprintf("required by MemcachedPolicy %s", p.Name)))
+		}
+	}
+	return errs
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	SchemeBuilder.Register(&MemcachedPolicy{}, &MemcachedPolicyList{})
+}
@@ -0,0 +1,97 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// commandForMemcached returns the memcached container command for the given memcached CR. The
+// flags are always rendered in the same order, so an unchanged config does not roll the members.
+func commandForMemcached(m *cachev1alpha1.Memcached) []string {
+	command := []string{"memcached", "-m=" + strconv.FormatInt(m.Spec.CacheMemoryMB(), 10)}
+	options := []string{"modern"}
+	if config := m.Spec.Config; config != nil {
+		command = appendIntFlag(command, "-t", config.Threads)
+		command = appendIntFlag(command, "-c", config.MaxConnections)
+		if config.MaxItemSize != nil {
+			command = append(command, "-I", strconv.FormatInt(config.MaxItemSize.Value(), 10))
+		}
+		command = appendIntFlag(command, "-b", config.ListenBacklog)
+		options = append(options, extendedOptionsForConfig(config)...)
+	}
+	return append(command, "-o", strings.Join(options, ","), "-v")
+}
+
+// appendIntFlag appends the flag with the given value to the command, unless the value is nil.
+func appendIntFlag(command []string, flag string, value *int32) []string {
+	if value == nil {
+		return command
+	}
+	return append(command, flag, strconv.Itoa(int(*value)))
+}
+
+// extendedOptionsForConfig returns the -o options of the given config: the LRU and slab automove
+// options first, then the extended options sorted by key. Extended options the operator sets
+// itself are dropped.
+func extendedOptionsForConfig(config *cachev1alpha1.Config) []string {
+	var options []string
+	if config.LRUCrawler != nil {
+		options = append(options, toggleOption("lru_crawler", *config.LRUCrawler))
+	}
+	if config.LRUMaintainer != nil {
+		options = append(options, toggleOption("lru_maintainer", *config.LRUMaintainer))
+	}
+	options = appendIntOption(options, "hot_lru_pct", config.HotLRUPercent)
+	options = appendIntOption(options, "warm_lru_pct", config.WarmLRUPercent)
+	options = appendIntOption(options, "slab_automove", config.SlabAutomove)
+	options = appendIntOption(options, "slab_automove_window", config.SlabAutomoveWindow)
+
+	keys := make([]string, 0, len(config.ExtendedOptions))
+	for key := range config.ExtendedOptions {
+		if !cachev1alpha1.IsReservedOption(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := config.ExtendedOptions[key]; value != "" {
+			options = append(options, key+"="+value)
+		} else {
+			options = append(options, key)
+		}
+	}
+	return options
+}
+
+// toggleOption returns the option enabling, or with the no_ prefix disabling, the named feature.
+func toggleOption(name string, enabled bool) string {
+	if enabled {
+		return name
+	}
+	return "no_" + name
+}
+
+// appendIntOption appends the option with the given value to the options, unless the value is nil.
+func appendIntOption(options []string, name string, value *int32) []string {
+	if value == nil {
+		return options
+	}
+	return append(options, name+"="+strconv.Itoa(int(*value)))
+}
@@ -0,0 +1,113 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+func TestCommandForMemcached(t *testing.T) {
+	int32Ptr := func(n int32) *int32 { return &n }
+	boolPtr := func(b bool) *bool { return &b }
+	itemSize := resource.MustParse("2Mi")
+	tests := []struct {
+		name    string
+		config  *cachev1alpha1.Config
+		command []string
+	}{
+		{
+			name:    "no config",
+			command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
+		},
+		{
+			name:    "threads",
+			config:  &cachev1alpha1.Config{Threads: int32Ptr(8)},
+			command: []string{"memcached", "-m=64", "-t", "8", "-o", "modern", "-v"},
+		},
+		{
+			name:    "max connections",
+			config:  &cachev1alpha1.Config{MaxConnections: int32Ptr(4096)},
+			command: []string{"memcached", "-m=64", "-c", "4096", "-o", "modern", "-v"},
+		},
+		{
+			name:    "max item size",
+			config:  &cachev1alpha1.Config{MaxItemSize: &itemSize},
+			command: []string{"memcached", "-m=64", "-I", "2097152", "-o", "modern", "-v"},
+		},
+		{
+			name:    "listen backlog",
+			config:  &cachev1alpha1.Config{ListenBacklog: int32Ptr(2048)},
+			command: []string{"memcached", "-m=64", "-b", "2048", "-o", "modern", "-v"},
+		},
+		{
+			name:    "LRU crawler disabled",
+			config:  &cachev1alpha1.Config{LRUCrawler: boolPtr(false)},
+			command: []string{"memcached", "-m=64", "-o", "modern,no_lru_crawler", "-v"},
+		},
+		{
+			name:    "LRU maintainer enabled",
+			config:  &cachev1alpha1.Config{LRUMaintainer: boolPtr(true)},
+			command: []string{"memcached", "-m=64", "-o", "modern,lru_maintainer", "-v"},
+		},
+		{
+			name:    "LRU percentages",
+			config:  &cachev1alpha1.Config{HotLRUPercent: int32Ptr(10), WarmLRUPercent: int32Ptr(50)},
+			command: []string{"memcached", "-m=64", "-o", "modern,hot_lru_pct=10,warm_lru_pct=50", "-v"},
+		},
+		{
+			name:    "slab automove",
+			config:  &cachev1alpha1.Config{SlabAutomove: int32Ptr(2), SlabAutomoveWindow: int32Ptr(60)},
+			command: []string{"memcached", "-m=64", "-o", "modern,slab_automove=2,slab_automove_window=60", "-v"},
+		},
+		{
+			name: "extended options sorted, reserved ones dropped",
+			config: &cachev1alpha1.Config{ExtendedOptions: map[string]string{
+				"watcher_logbuf_size": "256", "no_hashexpand": "", "modern": "", "ssl_key": "/tmp/key",
+			}},
+			command: []string{"memcached", "-m=64", "-o", "modern,no_hashexpand,watcher_logbuf_size=256", "-v"},
+		},
+		{
+			name: "every flag",
+			config: &cachev1alpha1.Config{
+				Threads:            int32Ptr(4),
+				MaxConnections:     int32Ptr(1024),
+				MaxItemSize:        &itemSize,
+				ListenBacklog:      int32Ptr(512),
+				LRUCrawler:         boolPtr(true),
+				LRUMaintainer:      boolPtr(true),
+				HotLRUPercent:      int32Ptr(20),
+				WarmLRUPercent:     int32Ptr(40),
+				SlabAutomove:       int32Ptr(1),
+				SlabAutomoveWindow: int32Ptr(30),
+				ExtendedOptions:    map[string]string{"tail_repair_time": "0"},
+			},
+			command: []string{"memcached", "-m=64", "-t", "4", "-c", "1024", "-I", "2097152", "-b", "512", "-o",
+				"modern,lru_crawler,lru_maintainer,hot_lru_pct=20,warm_lru_pct=40,slab_automove=1,slab_automove_window=30,tail_repair_time=0", "-v"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &cachev1alpha1.Memcached{Spec: cachev1alpha1.MemcachedSpec{Size: 1, Config: tt.config}}
+			if command := commandForMemcached(m); !reflect.DeepEqual(command, tt.command) {
+				t.Errorf("command %v is not the expected command %v", command, tt.command)
+			}
+		})
+	}
+}
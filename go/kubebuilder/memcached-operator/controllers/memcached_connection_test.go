@@ -0,0 +1,121 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedConnectionInfo checks that the connection info follows the ready members, and moves
+// to a Secret when SASL is enabled.
+func TestMemcachedConnectionInfo(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	pod := func(name, ip string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+			Status: corev1.PodStatus{
+				PodIP:      ip,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+	r, cl, _ := newTestReconciler(memcached, pod("b", "10.0.0.2", true), pod("a", "10.0.0.1", true), pod("c", "10.0.0.3", false))
+	req := requestFor(memcached)
+	key := types.NamespacedName{Name: connectionInfoName(memcached.Name), Namespace: memcached.Namespace}
+	reconcileTimes(t, r, req, 2)
+
+	// The ready members are published ordered by name, next to the Service.
+	configMap := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), key, configMap); err != nil {
+		t.Fatalf("get connection info: (%v)", err)
+	}
+	expected := map[string]string{
+		connectionAddressKey:  "memcached-operator.memcached.svc:11211",
+		connectionMembersKey:  "10.0.0.1:11211,10.0.0.2:11211",
+		connectionProtocolKey: "ascii",
+		connectionTLSKey:      "false",
+	}
+	if !reflect.DeepEqual(configMap.Data, expected) {
+		t.Errorf("connection info %v is not the expected %v", configMap.Data, expected)
+	}
+	for label, value := range connectionInfoLabels(memcached) {
+		if configMap.Labels[label] != value {
+			t.Errorf("connection info label %s (%s) is not %s", label, configMap.Labels[label], value)
+		}
+	}
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	ref := cachev1alpha1.ConnectionInfoReference{Kind: "ConfigMap", Name: key.Name}
+	if updated.Status.ConnectionInfo == nil || *updated.Status.ConnectionInfo != ref {
+		t.Errorf("status connection info %v is not %v", updated.Status.ConnectionInfo, ref)
+	}
+
+	// A member becoming ready is published.
+	if err := cl.Update(context.TODO(), pod("c", "10.0.0.3", true)); err != nil {
+		t.Fatalf("update pod: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 2)
+	if err := cl.Get(context.TODO(), key, configMap); err != nil {
+		t.Fatalf("get connection info: (%v)", err)
+	}
+	if members := configMap.Data[connectionMembersKey]; members != "10.0.0.1:11211,10.0.0.2:11211,10.0.0.3:11211" {
+		t.Errorf("connection info members (%s) do not include the ready member", members)
+	}
+
+	// Enabling SASL moves the connection info to a Secret.
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.Auth = &cachev1alpha1.Auth{SASL: &cachev1alpha1.SASLAuth{Enabled: true}}
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 2)
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), key, secret); err != nil {
+		t.Fatalf("get connection info secret: (%v)", err)
+	}
+	if protocol := string(secret.Data[connectionProtocolKey]); protocol != "binary" {
+		t.Errorf("connection info protocol (%s) is not binary with SASL", protocol)
+	}
+	if err := cl.Get(context.TODO(), key, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("connection info ConfigMap was not deleted: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	ref.Kind = "Secret"
+	if updated.Status.ConnectionInfo == nil || *updated.Status.ConnectionInfo != ref {
+		t.Errorf("status connection info %v is not %v", updated.Status.ConnectionInfo, ref)
+	}
+}
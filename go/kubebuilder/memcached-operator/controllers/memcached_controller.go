@@ -17,16 +17,27 @@ package controllers
 import (
 	"context"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
 )
@@ -34,14 +45,31 @@ import (
 // MemcachedReconciler reconciles a Memcached object
 type MemcachedReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads objects the reconciler does not watch directly from the API server
+	APIReader client.Reader
+	// OperatorPeer selects the operator pods in the NetworkPolicies restricting the access to the
+	// members, nil when the operator does not run in the cluster
+	OperatorPeer *networkingv1.NetworkPolicyPeer
 }
 
 // +kubebuilder:rbac:groups=cache.example.com,resources=memcacheds,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cache.example.com,resources=memcacheds/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=cache.example.com,resources=memcachedusers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cache.example.com,resources=memcachedusers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;create;update;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;create;update;delete
 
 func (r *MemcachedReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -53,9 +81,10 @@ func (r *MemcachedReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, the teardown already ran on deletion.
 			// Return and don't requeue
 			log.Info("Memcached resource not found. Ignoring since object must be deleted")
+			deleteReplicasMetric(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -63,40 +92,43 @@ func (r *MemcachedReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
-	// Check if the deployment already exists, if not create a new one
-	found := &appsv1.Deployment{}
-	err = r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new deployment
-		dep := r.deploymentForMemcached(memcached)
-		log.Info("Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
-		err = r.Create(ctx, dep)
-		if err != nil {
-			log.Error(err, "Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+	// Tear down a deleted Memcached before releasing it, otherwise hold it with a finalizer
+	if memcached.GetDeletionTimestamp() != nil {
+		return r.finalizeMemcached(ctx, log, memcached)
+	}
+	if !hasFinalizer(memcached) {
+		controllerutil.AddFinalizer(memcached, memcachedFinalizer)
+		if err := r.Update(ctx, memcached); err != nil {
+			log.Error(err, "Failed to add finalizer")
 			return ctrl.Result{}, err
 		}
-		// Deployment created successfully - return and requeue
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Deployment")
-		return ctrl.Result{}, err
 	}
+	r.recordSpecWarnings(memcached)
 
-	// Ensure the deployment size is the same as the spec
-	size := memcached.Spec.Size
-	if *found.Spec.Replicas != size {
-		found.Spec.Replicas = &size
-		err = r.Update(ctx, found)
+	// Leave the owned objects alone while the Memcached is paused, only reporting their state
+	paused := memcached.IsPaused()
+	var members *memberState
+	if paused {
+		members, err = r.observeMembers(ctx, log, memcached)
 		if err != nil {
-			log.Error(err, "Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			log.Error(err, "Failed to observe paused Memcached")
 			return ctrl.Result{}, err
 		}
-		// Spec updated - return and requeue
-		return ctrl.Result{Requeue: true}, nil
+	} else {
+		var requeue bool
+		members, requeue, err = r.reconcileMembers(ctx, log, memcached)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if requeue {
+			return ctrl.Result{Requeue: true}, nil
+		}
 	}
+	workload := members.workload
 
 	// Update the Memcached status with the pod names
-	// List the pods for this memcached's deployment
+	phaseStart := time.Now()
+	// List the pods for this memcached's workload
 	podList := &corev1.PodList{}
 	listOpts := []client.ListOption{
 		client.InNamespace(memcached.Namespace),
@@ -108,21 +140,260 @@ func (r *MemcachedReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	podNames := getPodNames(podList.Items)
 
-	// Update status.Nodes if needed
-	if !reflect.DeepEqual(podNames, memcached.Status.Nodes) {
-		memcached.Status.Nodes = podNames
+	status := memcached.Status.DeepCopy()
+	status.Nodes = podNames
+	status.Members = r.membersForPods(ctx, podList.Items)
+	status.Zones = zonesForMembers(status.Members)
+
+	// Publish how clients connect to the members, which a paused Memcached leaves as it is
+	if !paused {
+		ref, err := r.reconcileConnectionInfo(ctx, log, memcached, status.Members, members.config)
+		if err != nil {
+			log.Error(err, "Failed to reconcile connection info")
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile connection info: %v", err)
+			return ctrl.Result{}, err
+		}
+		status.ConnectionInfo = ref
+	}
+
+	// Check the members answer memcached requests when probing is enabled
+	probeAfter := probeMembers(log, memcached, status.Members, members.dialer)
+
+	// Track the rollout of the requested version and users, which paused members do not follow
+	version := versionForMemcached(memcached)
+	if workload.rolledOut && !paused {
+		status.CurrentVersion = version
+		status.ActiveUsers = nil
+		if members.config.sasl != nil {
+			status.ActiveUsers = members.config.sasl.users
+		}
+		if restartedAt := memcached.Spec.RestartedAt; restartedAt != nil && !restartedAt.Equal(status.LastRestartTime) {
+			status.LastRestartTime = restartedAt.DeepCopy()
+			r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "Restarted", "Restarted every member at %s", restartedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	status.TargetVersion = ""
+	if status.CurrentVersion != version {
+		status.TargetVersion = version
+	}
+
+	// Derive the replica counts and conditions from the workload
+	status.ObservedGeneration = memcached.Generation
+	status.Replicas = workload.currentReplicas
+	status.ReadyReplicas = workload.readyReplicas
+	status.Selector = labels.SelectorFromSet(labelsForMemcached(memcached.Name)).String()
+	setConditions(status, workload, memcached.Generation)
+	setMembersDegraded(status, memcached.Generation)
+	setPausedCondition(status, paused, memcached.Generation)
+	r.recordPauseTransition(memcached, paused)
+	setReplicasMetric(memcached.Namespace, memcached.Name, workload.replicas, workload.readyReplicas)
+
+	// Update status if needed
+	if !reflect.DeepEqual(*status, memcached.Status) {
+		memcached.Status = *status
 		err := r.Status().Update(ctx, memcached)
 		if err != nil {
+			if errors.IsConflict(err) {
+				// The Memcached changed since it was read, reconcile it again
+				statusUpdateConflictsTotal.Inc()
+				log.Info("Memcached status update conflicted, requeueing")
+				return ctrl.Result{Requeue: true}, nil
+			}
 			log.Error(err, "Failed to update Memcached status")
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "StatusUpdateFailed", "Failed to update status: %v", err)
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// Report whether the members accept each user
+	if err := r.updateUserStatuses(ctx, log, memcached, members.users, memcached.Status.ActiveUsers); err != nil {
+		log.Error(err, "Failed to update MemcachedUser status")
+		return ctrl.Result{}, err
+	}
+	observePhase("status", phaseStart)
+
+	// Requeue to probe the members again once they are due, and to read the Secrets they mount again
+	requeueAfter := probeAfter
+	if config := members.config; config != nil && (config.sasl != nil || config.tls != nil) && (requeueAfter == 0 || requeueAfter > secretResyncPeriod) {
+		requeueAfter = secretResyncPeriod
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// memberState is the state of the members of a memcached CR its status is reported from
+type memberState struct {
+	// config is the configuration the members are rendered with, nil while the CR is paused
+	config *podConfig
+	// users are the SASL users of the CR, nil while the CR is paused
+	users []saslUser
+	// workload is the rollout state of the workload running the members
+	workload *workloadStatus
+	// dialer connects the operator to the members
+	dialer *memberDialer
+}
+
+// reconcileMembers creates or updates every object owned by the given memcached CR, and returns
+// the state of its members. It returns true when the request must be requeued to observe the
+// workload after a change.
+func (r *MemcachedReconciler) reconcileMembers(ctx context.Context, log logr.Logger, memcached *cachev1alpha1.Memcached) (*memberState, bool, error) {
+	// Render the SASL database from the users of the Memcached when SASL is enabled
+	phaseStart := time.Now()
+	sasl, users, err := r.reconcileSASL(ctx, log, memcached)
+	if err != nil {
+		log.Error(err, "Failed to reconcile SASL Secret")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile SASL Secret: %v", err)
+		return nil, false, err
+	}
+	observePhase("auth", phaseStart)
+
+	// Issue or read the certificate the members serve when TLS is enabled
+	phaseStart = time.Now()
+	tls, err := r.reconcileTLS(ctx, log, memcached)
+	if err != nil {
+		log.Error(err, "Failed to reconcile TLS certificates")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile TLS certificates: %v", err)
+		return nil, false, err
+	}
+	config := &podConfig{sasl: sasl, tls: tls}
+	observePhase("tls", phaseStart)
+
+	// Reconcile the Deployment or StatefulSet running the memcached pods
+	phaseStart = time.Now()
+	var workload *workloadStatus
+	var requeue bool
+	if memcached.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		workload, requeue, err = r.reconcileStatefulSet(ctx, log, memcached, config)
+	} else {
+		workload, requeue, err = r.reconcileDeployment(ctx, log, memcached, config)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	observePhase("workload", phaseStart)
+	if requeue {
+		return nil, true, nil
+	}
+
+	// After a workload type switch, remove the previous workload once the new one is rolled out
+	if workload.rolledOut {
+		if err := r.deleteInactiveWorkload(ctx, log, memcached); err != nil {
+			log.Error(err, "Failed to delete inactive workload")
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to delete inactive workload: %v", err)
+			return nil, false, err
+		}
+	}
+
+	// Check if the service already exists, if not create a new one
+	phaseStart = time.Now()
+	service := &corev1.Service{}
+	err = r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, service)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new service
+		svc := r.serviceForMemcached(memcached)
+		log.Info("Creating a new Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		err = r.Create(ctx, svc)
+		if err != nil {
+			log.Error(err, "Failed to create new Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create Service %s: %v", svc.Name, err)
+			return nil, false, err
+		}
+		recordOperation("Service", "create")
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created Service %s", svc.Name)
+	} else if err != nil {
+		log.Error(err, "Failed to get Service")
+		return nil, false, err
+	} else if err := r.patchServiceDrift(ctx, log, memcached, r.serviceForMemcached(memcached), service); err != nil {
+		log.Error(err, "Failed to patch Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update Service %s: %v", service.Name, err)
+		return nil, false, err
+	}
+
+	// Create or remove the headless service publishing a DNS record per member
+	if err := r.reconcileHeadlessService(ctx, log, memcached); err != nil {
+		log.Error(err, "Failed to reconcile headless Service")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile headless Service: %v", err)
+		return nil, false, err
+	}
+	observePhase("services", phaseStart)
+
+	// Limit the members voluntary disruptions may evict at once
+	phaseStart = time.Now()
+	if err := r.reconcilePodDisruptionBudget(ctx, log, memcached); err != nil {
+		log.Error(err, "Failed to reconcile PodDisruptionBudget")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile PodDisruptionBudget: %v", err)
+		return nil, false, err
+	}
+	observePhase("disruption_budget", phaseStart)
+
+	// Only admit the selected clients when access is restricted
+	phaseStart = time.Now()
+	if err := r.reconcileNetworkPolicy(ctx, log, memcached); err != nil {
+		log.Error(err, "Failed to reconcile NetworkPolicy")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile NetworkPolicy: %v", err)
+		return nil, false, err
+	}
+	observePhase("network_policy", phaseStart)
+
+	// Let the autoscaler choose the size when autoscaling is enabled
+	phaseStart = time.Now()
+	if err := r.reconcileHorizontalPodAutoscaler(ctx, log, memcached); err != nil {
+		log.Error(err, "Failed to reconcile HorizontalPodAutoscaler")
+		r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile HorizontalPodAutoscaler: %v", err)
+		return nil, false, err
+	}
+	observePhase("autoscaler", phaseStart)
+
+	return &memberState{config: config, users: users, workload: workload, dialer: config.dialer()}, false, nil
+}
+
+// reconcileDeployment creates the memcached Deployment or corrects its drift, and returns its rollout state.
+// It returns true when the request must be requeued to observe the Deployment after a change.
+func (r *MemcachedReconciler) reconcileDeployment(ctx context.Context, log logr.Logger, memcached *cachev1alpha1.Memcached, config *podConfig) (*workloadStatus, bool, error) {
+	// Check if the deployment already exists, if not create a new one
+	found := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new deployment
+		dep := r.deploymentForMemcached(memcached, config)
+		log.Info("Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		err = r.Create(ctx, dep)
+		if err != nil {
+			log.Error(err, "Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create Deployment %s: %v", dep.Name, err)
+			return nil, false, err
+		}
+		recordOperation("Deployment", "create")
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created Deployment %s", dep.Name)
+		// Deployment created successfully - return and requeue
+		return nil, true, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get Deployment")
+		return nil, false, err
+	}
+
+	// Ensure the deployment matches the spec, reverting manual edits of the fields the operator manages
+	original := found.DeepCopy()
+	if drift := correctDeploymentDrift(r.deploymentForMemcached(memcached, config), found); len(drift) > 0 {
+		log.Info("Correcting Deployment drift", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name, "Fields", drift)
+		err = r.Patch(ctx, found, client.MergeFrom(original))
+		if err != nil {
+			log.Error(err, "Failed to patch Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update Deployment %s: %v", found.Name, err)
+			return nil, false, err
+		}
+		recordOperation("Deployment", "update")
+		recordScale(original.Spec.Replicas, found.Spec.Replicas)
+		r.recordScaleEvent(memcached, "Deployment", found.Name, original.Spec.Replicas, found.Spec.Replicas)
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "DriftCorrected", "Corrected Deployment %s fields: %s", found.Name, strings.Join(drift, ", "))
+		// Spec updated - return and requeue
+		return nil, true, nil
+	}
+
+	return deploymentWorkloadStatus(found), false, nil
 }
 
 // deploymentForMemcached returns a memcached Deployment object
-func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached) *appsv1.Deployment {
+func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached, config *podConfig) *appsv1.Deployment {
 	ls := labelsForMemcached(m.Name)
 	replicas := m.Spec.Size
 
@@ -136,22 +407,7 @@ func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached)
 			Selector: &metav1.LabelSelector{
 				MatchLabels: ls,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image:   "memcached:1.4.36-alpine",
-						Name:    "memcached",
-						Command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 11211,
-							Name:          "memcached",
-						}},
-					}},
-				},
-			},
+			Template: podTemplateForMemcached(m, config),
 		},
 	}
 	// Set Memcached instance as the owner and controller
@@ -159,6 +415,204 @@ func (r *MemcachedReconciler) deploymentForMemcached(m *cachev1alpha1.Memcached)
 	return dep
 }
 
+// podConfig is the configuration of the members rendered from other objects than the memcached CR
+type podConfig struct {
+	// sasl is the SASL database the members authenticate clients with, nil when SASL is disabled
+	sasl *saslConfig
+	// tls is the certificate the members serve, nil when TLS is disabled
+	tls *tlsConfig
+}
+
+// dialer returns the dialer connecting the operator to the members configured with c.
+func (c *podConfig) dialer() *memberDialer {
+	dialer := &memberDialer{}
+	if c.sasl != nil {
+		dialer.credentials = c.sasl.credentials
+	}
+	if c.tls != nil {
+		dialer.tlsConfig = c.tls.clientConfig
+	}
+	return dialer
+}
+
+// podTemplateForMemcached returns the memcached pod template shared by the Deployment and StatefulSet
+func podTemplateForMemcached(m *cachev1alpha1.Memcached, config *podConfig) corev1.PodTemplateSpec {
+	ls := labelsForMemcached(m.Name)
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: ls,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image:     imageForMemcached(m),
+				Name:      "memcached",
+				Command:   commandForMemcached(m),
+				Resources: resourcesForMemcached(m),
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: 11211,
+					Name:          "memcached",
+				}},
+			}},
+		},
+	}
+	if config.sasl != nil {
+		addSASLToPodSpec(m, &template.Spec)
+	}
+	if config.tls != nil {
+		addTLSToPodSpec(m, &template.Spec)
+	}
+	addPlacementToPodSpec(m, &template.Spec)
+	template.Annotations = annotationsForPodTemplate(m, config, &template.Spec)
+	return template
+}
+
+// serviceForMemcached returns a memcached Service object
+func (r *MemcachedReconciler) serviceForMemcached(m *cachev1alpha1.Memcached) *corev1.Service {
+	ls := labelsForMemcached(m.Name)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: ls,
+			Ports: []corev1.ServicePort{{
+				Port: 11211,
+				Name: "memcached",
+			}},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, svc, r.Scheme)
+	return svc
+}
+
+// reconcileHeadlessService creates the headless service of the given memcached CR when it is
+// enabled in the spec, and deletes the one owned by the CR when it is not.
+func (r *MemcachedReconciler) reconcileHeadlessService(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: headlessServiceName(m.Name), Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if !headlessServiceEnabled(m) {
+			return nil
+		}
+		svc := r.headlessServiceForMemcached(m)
+		log.Info("Creating a new headless Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		if err := r.Create(ctx, svc); err != nil {
+			return err
+		}
+		recordOperation("Service", "create")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created headless Service %s", svc.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !headlessServiceEnabled(m) && metav1.IsControlledBy(found, m) {
+		log.Info("Deleting the headless Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+		if err := r.Delete(ctx, found); err != nil {
+			return err
+		}
+		recordOperation("Service", "delete")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted headless Service %s", found.Name)
+		return nil
+	}
+	if headlessServiceEnabled(m) && metav1.IsControlledBy(found, m) {
+		return r.patchServiceDrift(ctx, log, m, r.headlessServiceForMemcached(m), found)
+	}
+	return nil
+}
+
+// patchServiceDrift reverts manual edits of the fields the operator manages on the given Service of
+// the given memcached CR.
+func (r *MemcachedReconciler) patchServiceDrift(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached, desired, service *corev1.Service) error {
+	original := service.DeepCopy()
+	drift := correctServiceDrift(desired, service)
+	if len(drift) == 0 {
+		return nil
+	}
+	log.Info("Correcting Service drift", "Service.Namespace", service.Namespace, "Service.Name", service.Name, "Fields", drift)
+	if err := r.Patch(ctx, service, client.MergeFrom(original)); err != nil {
+		return err
+	}
+	recordOperation("Service", "update")
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, "DriftCorrected", "Corrected Service %s fields: %s", service.Name, strings.Join(drift, ", "))
+	return nil
+}
+
+// headlessServiceForMemcached returns a headless memcached Service object resolving to the individual pods
+func (r *MemcachedReconciler) headlessServiceForMemcached(m *cachev1alpha1.Memcached) *corev1.Service {
+	ls := labelsForMemcached(m.Name)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(m.Name),
+			Namespace: m.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  ls,
+			Ports: []corev1.ServicePort{{
+				Port: 11211,
+				Name: "memcached",
+			}},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, svc, r.Scheme)
+	return svc
+}
+
+// headlessServiceEnabled reports whether the given memcached CR needs a headless service,
+// either because it is requested or because it governs the StatefulSet.
+func headlessServiceEnabled(m *cachev1alpha1.Memcached) bool {
+	return m.Spec.HeadlessService || m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet
+}
+
+// headlessServiceName returns the name of the headless service of the given memcached CR name.
+func headlessServiceName(name string) string {
+	return name + "-headless"
+}
+
+// imageForMemcached returns the memcached container image reference for the given memcached CR.
+func imageForMemcached(m *cachev1alpha1.Memcached) string {
+	image := m.Spec.Image
+	if image == "" {
+		image = cachev1alpha1.DefaultImage
+	}
+	return image + ":" + versionForMemcached(m)
+}
+
+// resourcesForMemcached returns the memcached container resource requirements for the given memcached CR.
+// Memory requests and limits not set in the spec are sized to the cache plus its overhead.
+func resourcesForMemcached(m *cachev1alpha1.Memcached) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{}
+	if m.Spec.Resources != nil {
+		m.Spec.Resources.DeepCopyInto(&resources)
+	}
+	cacheMB := m.Spec.CacheMemoryMB()
+	memory := *resource.NewQuantity((cacheMB+cachev1alpha1.MemoryOverheadMB(cacheMB))*1024*1024, resource.BinarySI)
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if _, ok := resources.Limits[corev1.ResourceMemory]; !ok {
+		resources.Limits[corev1.ResourceMemory] = memory
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	if _, ok := resources.Requests[corev1.ResourceMemory]; !ok {
+		resources.Requests[corev1.ResourceMemory] = resources.Limits[corev1.ResourceMemory]
+	}
+	return resources
+}
+
+// versionForMemcached returns the memcached version requested by the given memcached CR.
+func versionForMemcached(m *cachev1alpha1.Memcached) string {
+	if m.Spec.Version == "" {
+		return cachev1alpha1.DefaultVersion
+	}
+	return m.Spec.Version
+}
+
 // labelsForMemcached returns the labels for selecting the resources
 // belonging to the given memcached CR name.
 func labelsForMemcached(name string) map[string]string {
@@ -178,5 +632,13 @@ func (r *MemcachedReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cachev1alpha1.Memcached{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&source.Kind{Type: &cachev1alpha1.MemcachedUser{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(memcachedForUser),
+		}).
 		Complete(r)
 }
@@ -0,0 +1,253 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// newTestReconciler returns a MemcachedReconciler backed by a fake client tracking the given
+// objects, along with that client and the recorder of its events.
+func newTestReconciler(objs ...runtime.Object) (*MemcachedReconciler, client.Client, *record.FakeRecorder) {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = cachev1alpha1.AddToScheme(s)
+	cl := fake.NewFakeClientWithScheme(s, objs...)
+	recorder := record.NewFakeRecorder(20)
+	r := &MemcachedReconciler{
+		Client:    cl,
+		Log:       ctrl.Log.WithName("controllers").WithName("Memcached"),
+		Scheme:    s,
+		Recorder:  recorder,
+		APIReader: cl,
+	}
+	return r, cl, recorder
+}
+
+// requestFor returns the reconcile request of the given memcached CR.
+func requestFor(m *cachev1alpha1.Memcached) ctrl.Request {
+	return ctrl.Request{NamespacedName: types.NamespacedName{Name: m.Name, Namespace: m.Namespace}}
+}
+
+// reconcileTimes reconciles the given request the given number of times, failing on any error.
+func reconcileTimes(t *testing.T, r *MemcachedReconciler, req ctrl.Request, times int) ctrl.Result {
+	t.Helper()
+	var res ctrl.Result
+	for i := 0; i < times; i++ {
+		var err error
+		if res, err = r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	return res
+}
+
+// expectEvents checks that the recorder holds exactly the given events, in order.
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+	t.Helper()
+	for _, want := range expected {
+		select {
+		case got := <-recorder.Events:
+			if got != want {
+				t.Errorf("event %q is not the expected event %q", got, want)
+			}
+		default:
+			t.Errorf("expected event %q was not recorded", want)
+		}
+	}
+	select {
+	case got := <-recorder.Events:
+		t.Errorf("unexpected event %q", got)
+	default:
+	}
+}
+
+// drainEvents discards the events recorded so far.
+func drainEvents(recorder *record.FakeRecorder) {
+	for {
+		select {
+		case <-recorder.Events:
+		default:
+			return
+		}
+	}
+}
+
+// metricValue scrapes the controller-runtime metrics registry and returns the value of the series
+// with the given name and labels, or the sample count of a histogram.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: (%v)", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if v, ok := labels[label.GetName()]; ok && v != label.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				return m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+// failingStatusClient is a client whose status updates always fail with the given error.
+type failingStatusClient struct {
+	client.Client
+	err error
+}
+
+func (c failingStatusClient) Status() client.StatusWriter {
+	return failingStatusWriter{c.err}
+}
+
+type failingStatusWriter struct {
+	err error
+}
+
+func (w failingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return w.err
+}
+
+func (w failingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.err
+}
+
+// conflictError returns the error of a Memcached update that conflicted.
+func conflictError() error {
+	return errors.NewConflict(cachev1alpha1.GroupVersion.WithResource("memcacheds").GroupResource(), "", nil)
+}
+
+// TestMemcachedServices checks that the Service and the headless Service select the members, and
+// that their drift is corrected.
+func TestMemcachedServices(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3, HeadlessService: true},
+	}
+	r, cl, recorder := newTestReconciler(memcached)
+	req := requestFor(memcached)
+	headlessKey := types.NamespacedName{Name: headlessServiceName(memcached.Name), Namespace: memcached.Namespace}
+
+	// The first pass creates the Deployment, the second the Services.
+	reconcileTimes(t, r, req, 2)
+	expectEvents(t, recorder,
+		"Normal Created Created Deployment memcached-operator",
+		"Normal Created Created Service memcached-operator",
+		"Normal Created Created headless Service memcached-operator-headless",
+		"Normal Created Created PodDisruptionBudget memcached-operator",
+		"Normal Created Created connection info ConfigMap memcached-operator-connection",
+	)
+
+	headless := &corev1.Service{}
+	if err := cl.Get(context.TODO(), headlessKey, headless); err != nil {
+		t.Fatalf("get headless service: (%v)", err)
+	}
+	if headless.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Errorf("headless service has cluster IP %q", headless.Spec.ClusterIP)
+	}
+	if !reflect.DeepEqual(headless.Spec.Selector, labelsForMemcached(memcached.Name)) {
+		t.Errorf("headless service selects %v instead of the memcached pods", headless.Spec.Selector)
+	}
+	ports := []corev1.ServicePort{{Name: "memcached", Port: 11211}}
+	if !reflect.DeepEqual(headless.Spec.Ports, ports) {
+		t.Errorf("headless service ports %v are not the expected ports %v", headless.Spec.Ports, ports)
+	}
+	if owner := metav1.GetControllerOf(headless); owner == nil || owner.Kind != "Memcached" || owner.Name != memcached.Name {
+		t.Errorf("headless service is controlled by %v instead of the memcached", owner)
+	}
+
+	// Edits of the managed fields are reverted, the fields defaulted by the API server are kept.
+	service := &corev1.Service{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, service); err != nil {
+		t.Fatalf("get service: (%v)", err)
+	}
+	service.Spec.ClusterIP = "10.0.0.10"
+	service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Name: "extra", Port: 8080})
+	if err := cl.Update(context.TODO(), service); err != nil {
+		t.Fatalf("update service: (%v)", err)
+	}
+	headless.Spec.Selector = map[string]string{"app": "other"}
+	headless.Spec.Ports[0].Protocol = corev1.ProtocolTCP
+	headless.Spec.Ports[0].TargetPort = intstr.FromInt(11211)
+	if err := cl.Update(context.TODO(), headless); err != nil {
+		t.Fatalf("update headless service: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	expectEvents(t, recorder,
+		"Normal DriftCorrected Corrected Service memcached-operator fields: spec.ports",
+		"Normal DriftCorrected Corrected Service memcached-operator-headless fields: spec.selector",
+	)
+	if err := cl.Get(context.TODO(), req.NamespacedName, service); err != nil {
+		t.Fatalf("get service: (%v)", err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.ClusterIP != "10.0.0.10" {
+		t.Errorf("service drift was not corrected: ports %v, cluster IP %q", service.Spec.Ports, service.Spec.ClusterIP)
+	}
+	if err := cl.Get(context.TODO(), headlessKey, headless); err != nil {
+		t.Fatalf("get headless service: (%v)", err)
+	}
+	if !reflect.DeepEqual(headless.Spec.Selector, labelsForMemcached(memcached.Name)) {
+		t.Errorf("headless service selector %v was not corrected", headless.Spec.Selector)
+	}
+	if headless.Spec.Ports[0].Protocol != corev1.ProtocolTCP {
+		t.Errorf("headless service port %v lost its defaulted protocol", headless.Spec.Ports[0])
+	}
+
+	// Disabling the headless Service deletes it.
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	memcached.Spec.HeadlessService = false
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	if err := cl.Get(context.TODO(), headlessKey, headless); !errors.IsNotFound(err) {
+		t.Errorf("headless service not deleted: (%v)", err)
+	}
+	expectEvents(t, recorder, "Normal Deleted Deleted headless Service memcached-operator-headless")
+}
@@ -0,0 +1,118 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestCorrectDeploymentDrift checks that server-defaulted fields are not reported as drift while
+// manual edits are reverted.
+func TestCorrectDeploymentDrift(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	r, _, _ := newTestReconciler()
+	desired := r.deploymentForMemcached(memcached, &podConfig{})
+
+	// Fields defaulted by the API server are not drift.
+	actual := desired.DeepCopy()
+	actual.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	actual.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	actual.Spec.Template.Spec.Containers[0].Ports[0].Protocol = corev1.ProtocolTCP
+	actual.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = "now"
+	if drift := correctDeploymentDrift(desired, actual); len(drift) != 0 {
+		t.Errorf("server-defaulted fields reported as drift: %v", drift)
+	}
+
+	// Manual edits are reported and reverted.
+	actual.Spec.Template.Spec.Containers[0].Image = "memcached:latest"
+	actual.Spec.Template.Spec.Containers[0].Ports = append(actual.Spec.Template.Spec.Containers[0].Ports, corev1.ContainerPort{ContainerPort: 11212})
+	actual.Spec.Template.Labels["app"] = "edited"
+	expected := []string{
+		"spec.template.metadata.labels",
+		"spec.template.spec.containers[0].image",
+		"spec.template.spec.containers[0].ports",
+	}
+	if drift := correctDeploymentDrift(desired, actual); !reflect.DeepEqual(drift, expected) {
+		t.Errorf("drift %v did not match expected %v", drift, expected)
+	}
+	if drift := correctDeploymentDrift(desired, actual); len(drift) != 0 {
+		t.Errorf("drift %v was not corrected", drift)
+	}
+}
+
+// TestMemcachedWorkloadDrift checks that manual edits of the Deployment and the StatefulSet are
+// reverted by Reconcile and reported in an event.
+func TestMemcachedWorkloadDrift(t *testing.T) {
+	for _, workloadType := range []cachev1alpha1.WorkloadType{cachev1alpha1.WorkloadTypeDeployment, cachev1alpha1.WorkloadTypeStatefulSet} {
+		t.Run(string(workloadType), func(t *testing.T) {
+			memcached := &cachev1alpha1.Memcached{
+				ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+				Spec:       cachev1alpha1.MemcachedSpec{Size: 3, WorkloadType: workloadType},
+			}
+			r, cl, recorder := newTestReconciler(memcached)
+			req := requestFor(memcached)
+			reconcileTimes(t, r, req, 2)
+			drainEvents(recorder)
+
+			// Edit the replicas, the image and a label of the pod template behind the operator's back.
+			var obj runtime.Object
+			var template *corev1.PodTemplateSpec
+			var replicas **int32
+			if workloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+				sts := &appsv1.StatefulSet{}
+				obj, template, replicas = sts, &sts.Spec.Template, &sts.Spec.Replicas
+			} else {
+				dep := &appsv1.Deployment{}
+				obj, template, replicas = dep, &dep.Spec.Template, &dep.Spec.Replicas
+			}
+			if err := cl.Get(context.TODO(), req.NamespacedName, obj); err != nil {
+				t.Fatalf("get %s: (%v)", workloadType, err)
+			}
+			one := int32(1)
+			*replicas = &one
+			template.Spec.Containers[0].Image = "memcached:latest"
+			template.Labels["app"] = "edited"
+			if err := cl.Update(context.TODO(), obj); err != nil {
+				t.Fatalf("update %s: (%v)", workloadType, err)
+			}
+
+			reconcileTimes(t, r, req, 1)
+			expectEvents(t, recorder,
+				"Normal Scaled Scaled "+string(workloadType)+" memcached-operator from 1 to 3 members",
+				"Normal DriftCorrected Corrected "+string(workloadType)+" memcached-operator fields: spec.replicas, "+
+					"spec.template.metadata.labels, spec.template.spec.containers[0].image",
+			)
+			if err := cl.Get(context.TODO(), req.NamespacedName, obj); err != nil {
+				t.Fatalf("get %s: (%v)", workloadType, err)
+			}
+			if **replicas != 3 || template.Spec.Containers[0].Image != imageForMemcached(memcached) || template.Labels["app"] != "memcached" {
+				t.Errorf("%s drift was not corrected: %d replicas, image %s, labels %v",
+					workloadType, **replicas, template.Spec.Containers[0].Image, template.Labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+const (
+	// memcachedFinalizer holds a deleted memcached CR until its teardown completed
+	memcachedFinalizer = "cache.example.com/teardown"
+	// teardownRetryPeriod is how long to wait before retrying a failed teardown
+	teardownRetryPeriod = 5 * time.Second
+	// flushMemberTimeout is how long a member has to answer the flush_all command
+	flushMemberTimeout = 5 * time.Second
+)
+
+// hasFinalizer reports whether the teardown finalizer is set on the given memcached CR.
+func hasFinalizer(m *cachev1alpha1.Memcached) bool {
+	for _, f := range m.GetFinalizers() {
+		if f == memcachedFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownTimeout returns how long the teardown of the given memcached CR may take.
+func teardownTimeout(m *cachev1alpha1.Memcached) time.Duration {
+	if m.Spec.TeardownTimeoutSeconds > 0 {
+		return time.Duration(m.Spec.TeardownTimeoutSeconds) * time.Second
+	}
+	return cachev1alpha1.DefaultTeardownTimeoutSeconds * time.Second
+}
+
+// finalizeMemcached runs the teardown of a deleted memcached CR, then removes its finalizer so
+// the CR and the objects it owns are garbage collected. A failed teardown is retried until the
+// teardown timeout passed since the deletion, then the CR is released with the remaining steps skipped.
+func (r *MemcachedReconciler) finalizeMemcached(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) (ctrl.Result, error) {
+	if !hasFinalizer(m) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.teardownMemcached(ctx, log, m); err != nil {
+		timeout := teardownTimeout(m)
+		left := m.GetDeletionTimestamp().Add(timeout).Sub(time.Now())
+		if left > 0 {
+			log.Error(err, "Failed to tear down Memcached, retrying")
+			r.Recorder.Eventf(m, corev1.EventTypeWarning, "TeardownFailed", "Failed to tear down: %v", err)
+			if left > teardownRetryPeriod {
+				left = teardownRetryPeriod
+			}
+			return ctrl.Result{RequeueAfter: left}, nil
+		}
+		log.Error(err, "Memcached teardown timed out, releasing it")
+		r.Recorder.Eventf(m, corev1.EventTypeWarning, "TeardownTimedOut", "Teardown did not complete within %s, skipping it: %v", timeout, err)
+	}
+
+	controllerutil.RemoveFinalizer(m, memcachedFinalizer)
+	if err := r.Update(ctx, m); err != nil {
+		log.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	log.Info("Released deleted Memcached")
+	return ctrl.Result{}, nil
+}
+
+// teardownMemcached flushes the members of the given memcached CR when its deletion policy asks
+// for it, then removes the connection info published for it.
+func (r *MemcachedReconciler) teardownMemcached(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	if m.Spec.DeletionPolicy == cachev1alpha1.DeletionPolicyFlush {
+		dialer, err := dialerForMemcached(ctx, r.APIReader, m)
+		if err != nil {
+			return err
+		}
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList, client.InNamespace(m.Namespace), client.MatchingLabels(labelsForMemcached(m.Name))); err != nil {
+			return err
+		}
+		var addrs []string
+		for _, pod := range podList.Items {
+			if pod.Status.PodIP != "" && pod.DeletionTimestamp == nil {
+				addrs = append(addrs, net.JoinHostPort(pod.Status.PodIP, "11211"))
+			}
+		}
+		if err := flushMembers(addrs, flushMemberTimeout, dialer); err != nil {
+			return err
+		}
+		log.Info("Flushed Memcached members", "Members", len(addrs))
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Flushed", "Flushed %d members", len(addrs))
+	}
+	return r.deleteConnectionInfo(ctx, log, m)
+}
+
+// flushMembers invalidates every item cached by the members at the given addresses, concurrently,
+// connecting to them with the given dialer.
+func flushMembers(addrs []string, timeout time.Duration, dialer *memberDialer) error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := flushMember(addr, timeout, dialer); err != nil {
+				mu.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", addr, err))
+				mu.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to flush members: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// flushMember invalidates every item cached by the member at the given address.
+func flushMember(addr string, timeout time.Duration, dialer *memberDialer) error {
+	conn, err := dialer.dial(addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.FlushAll()
+}
+
+// connectionInfoLabels returns the labels of the Secrets and ConfigMaps publishing how to connect
+// to the given memcached CR. They are not owned by the CR as they may live in other namespaces.
+func connectionInfoLabels(m *cachev1alpha1.Memcached) map[string]string {
+	return map[string]string{
+		"cache.example.com/memcached-name":      m.Name,
+		"cache.example.com/memcached-namespace": m.Namespace,
+	}
+}
+
+// deleteConnectionInfo deletes the Secrets and ConfigMaps publishing how to connect to the given
+// memcached CR, in every namespace. They are listed from the API server, so the operator does
+// not cache every Secret of the cluster.
+func (r *MemcachedReconciler) deleteConnectionInfo(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	secrets := &corev1.SecretList{}
+	if err := r.APIReader.List(ctx, secrets, client.MatchingLabels(connectionInfoLabels(m))); err != nil {
+		return err
+	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.APIReader.List(ctx, configMaps, client.MatchingLabels(connectionInfoLabels(m))); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		if err := r.deleteConnectionInfoObject(ctx, log, m, "Secret", &secrets.Items[i]); err != nil {
+			return err
+		}
+	}
+	for i := range configMaps.Items {
+		if err := r.deleteConnectionInfoObject(ctx, log, m, "ConfigMap", &configMaps.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteConnectionInfoObject deletes a Secret or ConfigMap publishing connection info of the given memcached CR.
+func (r *MemcachedReconciler) deleteConnectionInfoObject(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached, kind string, obj interface {
+	metav1.Object
+	runtime.Object
+}) error {
+	log.Info("Deleting connection info", kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+	if err := r.Delete(ctx, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	recordOperation(kind, "delete")
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted connection info %s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// serveFakeMemcached starts an in-process memcached server answering the stats command with the
+// given statistics.
+func serveFakeMemcached(t *testing.T, stats string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					response := "ERROR\r\n"
+					switch strings.TrimSpace(line) {
+					case "stats":
+						response = stats
+					case "flush_all":
+						response = "OK\r\n"
+					}
+					if _, err := conn.Write([]byte(response)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+// TestMemcachedTeardown checks that a failed flush is retried until the teardown times out, and
+// that the connection info is removed on release.
+func TestMemcachedTeardown(t *testing.T) {
+	deleted := metav1.NewTime(time.Now())
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "memcached-operator",
+			Namespace:         "memcached",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{memcachedFinalizer},
+		},
+		Spec: cachev1alpha1.MemcachedSpec{Size: 3, DeletionPolicy: cachev1alpha1.DeletionPolicyFlush, TeardownTimeoutSeconds: 60},
+	}
+	connectionInfo := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name: "memcached-operator-connection", Namespace: "memcached", Labels: connectionInfoLabels(memcached),
+	}}
+	unrelated := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "memcached"}}
+	// The member cannot be flushed as nothing serves memcached on its address.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator-0", Namespace: "memcached", Labels: labelsForMemcached(memcached.Name)},
+		Status:     corev1.PodStatus{PodIP: "127.0.0.1"},
+	}
+	r, cl, recorder := newTestReconciler(memcached, connectionInfo, unrelated, pod)
+	req := requestFor(memcached)
+
+	// A failed flush is retried while the teardown timeout has not passed.
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter <= 0 || res.RequeueAfter > teardownRetryPeriod {
+		t.Errorf("failed teardown is retried after %s instead of at most %s", res.RequeueAfter, teardownRetryPeriod)
+	}
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !hasFinalizer(memcached) {
+		t.Error("memcached was released before its members were flushed")
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning TeardownFailed") {
+		t.Errorf("event %q does not report the failed teardown", event)
+	}
+
+	// Once the timeout passed, the CR is released with the remaining steps skipped.
+	memcached.DeletionTimestamp = &metav1.Time{Time: deleted.Add(-time.Hour)}
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if hasFinalizer(memcached) {
+		t.Error("memcached was not released after the teardown timed out")
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning TeardownTimedOut") {
+		t.Errorf("event %q does not report the teardown timeout", event)
+	}
+
+	// Without flushing, the connection info is removed before the CR is released.
+	memcached.Finalizers = []string{memcachedFinalizer}
+	memcached.Spec.DeletionPolicy = cachev1alpha1.DeletionPolicyDelete
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if hasFinalizer(memcached) {
+		t.Error("memcached was not released after its teardown")
+	}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: connectionInfo.Name, Namespace: connectionInfo.Namespace}, &corev1.ConfigMap{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("connection info was not deleted: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: unrelated.Name, Namespace: unrelated.Namespace}, &corev1.ConfigMap{}); err != nil {
+		t.Errorf("get unrelated configmap: (%v)", err)
+	}
+}
+
+// TestFlushMembers checks that every member is flushed, and that an unreachable member fails the
+// flush.
+func TestFlushMembers(t *testing.T) {
+	listener := serveFakeMemcached(t, "END\r\n")
+	defer listener.Close()
+	if err := flushMembers([]string{listener.Addr().String()}, time.Second, nil); err != nil {
+		t.Errorf("flush members: (%v)", err)
+	}
+
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	down.Close()
+	if err := flushMembers([]string{listener.Addr().String(), down.Addr().String()}, time.Second, nil); err == nil {
+		t.Error("flushing an unreachable member did not fail")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// reconcileHorizontalPodAutoscaler creates or updates the HorizontalPodAutoscaler of the given
+// memcached CR when autoscaling is enabled in the spec, and deletes the one owned by the CR when
+// it is not. The autoscaler scales the CR itself through its scale subresource.
+func (r *MemcachedReconciler) reconcileHorizontalPodAutoscaler(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Autoscaling == nil {
+			return nil
+		}
+		hpa := r.horizontalPodAutoscalerForMemcached(m)
+		log.Info("Creating a new HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", hpa.Namespace, "HorizontalPodAutoscaler.Name", hpa.Name)
+		if err := r.Create(ctx, hpa); err != nil {
+			return err
+		}
+		recordOperation("HorizontalPodAutoscaler", "create")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created HorizontalPodAutoscaler %s", hpa.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Autoscaling == nil {
+		log.Info("Deleting the HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+		if err := r.Delete(ctx, found); err != nil {
+			return err
+		}
+		recordOperation("HorizontalPodAutoscaler", "delete")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted HorizontalPodAutoscaler %s", found.Name)
+		return nil
+	}
+
+	desired := r.horizontalPodAutoscalerForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	log.Info("Updating the HorizontalPodAutoscaler", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+	if err := r.Update(ctx, found); err != nil {
+		return err
+	}
+	recordOperation("HorizontalPodAutoscaler", "update")
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated HorizontalPodAutoscaler %s", found.Name)
+	return nil
+}
+
+// horizontalPodAutoscalerForMemcached returns a HorizontalPodAutoscaler object scaling the given memcached CR
+func (r *MemcachedReconciler) horizontalPodAutoscalerForMemcached(m *cachev1alpha1.Memcached) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	autoscaling := m.Spec.Autoscaling
+	minReplicas := int32(1)
+	if autoscaling.MinReplicas != nil {
+		minReplicas = *autoscaling.MinReplicas
+	}
+	var metrics []autoscalingv2beta2.MetricSpec
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	if len(metrics) == 0 {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceCPU, cachev1alpha1.DefaultTargetCPUUtilizationPercentage))
+	}
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: cachev1alpha1.GroupVersion.String(),
+				Kind:       "Memcached",
+				Name:       m.Name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, hpa, r.Scheme)
+	return hpa
+}
+
+// resourceMetricForMemcached returns an autoscaler metric targeting the given average
+// utilization of a resource of the memcached pods.
+func resourceMetricForMemcached(name corev1.ResourceName, utilization int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// objectOperationsTotal counts the objects the reconciler created, updated or deleted, by kind
+	objectOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "memcached_operator_object_operations_total",
+		Help: "Number of objects created, updated or deleted by the memcached reconciler.",
+	}, []string{"kind", "operation"})
+
+	// scaleOperationsTotal counts the replica changes applied to the memcached workloads
+	scaleOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "memcached_operator_scale_operations_total",
+		Help: "Number of times the memcached reconciler scaled a workload up or down.",
+	}, []string{"direction"})
+
+	// statusUpdateConflictsTotal counts the Memcached status updates rejected because the CR changed
+	statusUpdateConflictsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "memcached_operator_status_update_conflicts_total",
+		Help: "Number of Memcached status updates that failed with a conflict.",
+	})
+
+	// reconcilePhaseDuration observes the time spent in each phase of a reconcile
+	reconcilePhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "memcached_operator_reconcile_phase_duration_seconds",
+		Help:    "Time spent in each phase of a memcached reconcile.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"phase"})
+
+	// memcachedReplicas reports the desired and ready members of every Memcached
+	memcachedReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "memcached_operator_replicas",
+		Help: "Number of desired and ready members of a Memcached.",
+	}, []string{"namespace", "memcached", "type"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		objectOperationsTotal,
+		scaleOperationsTotal,
+		statusUpdateConflictsTotal,
+		reconcilePhaseDuration,
+		memcachedReplicas,
+	)
+}
+
+// recordOperation counts an operation of the reconciler on an object of the given kind.
+func recordOperation(kind, operation string) {
+	objectOperationsTotal.WithLabelValues(kind, operation).Inc()
+}
+
+// recordScale counts a change of the replicas of a workload, if the replicas changed.
+func recordScale(from, to *int32) {
+	if from == nil || to == nil || *from == *to {
+		return
+	}
+	direction := "up"
+	if *to < *from {
+		direction = "down"
+	}
+	scaleOperationsTotal.WithLabelValues(direction).Inc()
+}
+
+// observePhase records the time spent in a reconcile phase that started at start.
+func observePhase(phase string, start time.Time) {
+	reconcilePhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// setReplicasMetric reports the desired and ready members of a Memcached.
+func setReplicasMetric(namespace, name string, desired, ready int32) {
+	memcachedReplicas.WithLabelValues(namespace, name, "desired").Set(float64(desired))
+	memcachedReplicas.WithLabelValues(namespace, name, "ready").Set(float64(ready))
+}
+
+// deleteReplicasMetric removes the replica series of a deleted Memcached.
+func deleteReplicasMetric(namespace, name string) {
+	memcachedReplicas.DeleteLabelValues(namespace, name, "desired")
+	memcachedReplicas.DeleteLabelValues(namespace, name, "ready")
+}
@@ -0,0 +1,126 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestReconcileMetrics checks the operational metrics recorded by Reconcile by scraping the
+// controller-runtime metrics registry.
+func TestReconcileMetrics(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	r, cl, recorder := newTestReconciler(memcached)
+	req := requestFor(memcached)
+
+	operations := func(kind, operation string) float64 {
+		return metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": kind, "operation": operation})
+	}
+	deploymentsCreated := operations("Deployment", "create")
+	servicesCreated := operations("Service", "create")
+	deploymentsUpdated := operations("Deployment", "update")
+	scaledUp := metricValue(t, "memcached_operator_scale_operations_total", map[string]string{"direction": "up"})
+	conflicts := metricValue(t, "memcached_operator_status_update_conflicts_total", nil)
+	workloadPhases := metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "workload"})
+	statusPhases := metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "status"})
+
+	// Create the Deployment, then the Service and the status.
+	reconcileTimes(t, r, req, 2)
+	// Scale the Deployment down behind the operator's back.
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	one := int32(1)
+	dep.Spec.Replicas = &one
+	dep.Status.ReadyReplicas = 1
+	if err := cl.Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment: (%v)", err)
+	}
+	// The corrected Deployment is observed again before the status is updated.
+	reconcileTimes(t, r, req, 2)
+
+	checks := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"deployments created", operations("Deployment", "create"), deploymentsCreated + 1},
+		{"services created", operations("Service", "create"), servicesCreated + 1},
+		{"deployments updated", operations("Deployment", "update"), deploymentsUpdated + 1},
+		{"scale ups", metricValue(t, "memcached_operator_scale_operations_total", map[string]string{"direction": "up"}), scaledUp + 1},
+		{"workload phases", metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "workload"}), workloadPhases + 4},
+		{"status phases", metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "status"}), statusPhases + 2},
+		{"desired replicas", metricValue(t, "memcached_operator_replicas", map[string]string{"namespace": "memcached", "memcached": "metrics", "type": "desired"}), 3},
+		{"ready replicas", metricValue(t, "memcached_operator_replicas", map[string]string{"namespace": "memcached", "memcached": "metrics", "type": "ready"}), 1},
+	}
+	for _, c := range checks {
+		if c.value != c.expected {
+			t.Errorf("%s metric (%v) is not the expected value (%v)", c.name, c.value, c.expected)
+		}
+	}
+
+	// A conflicting status update is counted and requeued.
+	drainEvents(recorder)
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	memcached.Generation = 2
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	r.Client = failingStatusClient{Client: cl, err: conflictError()}
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if !res.Requeue {
+		t.Error("reconcile did not requeue after a status update conflict")
+	}
+	if v := metricValue(t, "memcached_operator_status_update_conflicts_total", nil); v != conflicts+1 {
+		t.Errorf("status update conflicts metric (%v) is not the expected value (%v)", v, conflicts+1)
+	}
+
+	// Any other failed status update is returned and not counted as a conflict.
+	r.Client = failingStatusClient{Client: cl, err: errors.NewInternalError(errors.NewBadRequest("status"))}
+	if _, err := r.Reconcile(req); err == nil {
+		t.Error("reconcile did not fail on the failed status update")
+	}
+	if v := metricValue(t, "memcached_operator_status_update_conflicts_total", nil); v != conflicts+1 {
+		t.Errorf("status update conflicts metric (%v) counted a failed update that did not conflict", v)
+	}
+
+	// The replica series are removed with the Memcached.
+	r.Client = cl
+	if err := cl.Delete(context.TODO(), memcached); err != nil {
+		t.Fatalf("delete memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	for _, replicas := range []string{"desired", "ready"} {
+		if v := metricValue(t, "memcached_operator_replicas", map[string]string{"memcached": "metrics", "type": replicas}); v != 0 {
+			t.Errorf("%s replica series of a deleted Memcached still reported (%v)", replicas, v)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// reconcileNetworkPolicy creates or updates the NetworkPolicy admitting the clients of the given
+// memcached CR, and deletes the one owned by the CR when access is not restricted.
+func (r *MemcachedReconciler) reconcileNetworkPolicy(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Access == nil {
+			return nil
+		}
+		policy := r.networkPolicyForMemcached(m)
+		log.Info("Creating a new NetworkPolicy", "NetworkPolicy.Namespace", policy.Namespace, "NetworkPolicy.Name", policy.Name)
+		if err := r.Create(ctx, policy); err != nil {
+			return err
+		}
+		recordOperation("NetworkPolicy", "create")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created NetworkPolicy %s", policy.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Access == nil {
+		log.Info("Deleting the NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+		if err := r.Delete(ctx, found); err != nil {
+			return err
+		}
+		recordOperation("NetworkPolicy", "delete")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted NetworkPolicy %s", found.Name)
+		return nil
+	}
+
+	desired := r.networkPolicyForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	log.Info("Updating the NetworkPolicy", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+	if err := r.Update(ctx, found); err != nil {
+		return err
+	}
+	recordOperation("NetworkPolicy", "update")
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated NetworkPolicy %s", found.Name)
+	return nil
+}
+
+// networkPolicyForMemcached returns a NetworkPolicy only admitting the clients selected by the
+// access of the given memcached CR on the memcached port, and the operator while it connects to
+// the members.
+func (r *MemcachedReconciler) networkPolicyForMemcached(m *cachev1alpha1.Memcached) *networkingv1.NetworkPolicy {
+	clients := networkingv1.NetworkPolicyPeer{
+		PodSelector:       m.Spec.Access.PodSelector,
+		NamespaceSelector: m.Spec.Access.NamespaceSelector,
+	}
+	if clients.PodSelector == nil && clients.NamespaceSelector == nil {
+		clients.PodSelector = &metav1.LabelSelector{}
+	}
+	peers := []networkingv1.NetworkPolicyPeer{clients}
+	if operatorConnects(m) && r.OperatorPeer != nil {
+		peers = append(peers, *r.OperatorPeer)
+	}
+	protocol := corev1.ProtocolTCP
+	port := intstr.FromInt(11211)
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: labelsForMemcached(m.Name),
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+				From:  peers,
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, policy, r.Scheme)
+	return policy
+}
+
+// operatorConnects reports whether the operator connects to the members of the given memcached CR,
+// to probe them or to flush them on deletion.
+func operatorConnects(m *cachev1alpha1.Memcached) bool {
+	return m.Spec.Probe != nil || m.Spec.DeletionPolicy == cachev1alpha1.DeletionPolicyFlush
+}
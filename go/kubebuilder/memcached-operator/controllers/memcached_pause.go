@@ -0,0 +1,97 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// observeMembers returns the state of the members of the given paused memcached CR, without
+// creating or updating any object.
+func (r *MemcachedReconciler) observeMembers(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) (*memberState, error) {
+	workload, err := r.observeWorkload(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	// The Secrets the operator authenticates with may be missing or edited by hand while paused,
+	// the members are then probed without them and reported unreachable
+	dialer, err := dialerForMemcached(ctx, r.APIReader, m)
+	if err != nil {
+		log.Info("Failed to read the member credentials, probing without them", "error", err.Error())
+		dialer = nil
+	}
+	return &memberState{workload: workload, dialer: dialer}, nil
+}
+
+// observeWorkload returns the rollout state of the Deployment or StatefulSet running the members
+// of the given memcached CR, or the state of a workload without members when it does not exist.
+func (r *MemcachedReconciler) observeWorkload(ctx context.Context, m *cachev1alpha1.Memcached) (*workloadStatus, error) {
+	key := types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+	if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, key, sts); err == nil {
+			return statefulSetWorkloadStatus(sts), nil
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &workloadStatus{kind: "StatefulSet", replicas: m.Spec.Size}, nil
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, dep); err == nil {
+		return deploymentWorkloadStatus(dep), nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return &workloadStatus{kind: "Deployment", replicas: m.Spec.Size}, nil
+}
+
+// setPausedCondition sets the Paused condition of the memcached status.
+func setPausedCondition(status *cachev1alpha1.MemcachedStatus, paused bool, generation int64) {
+	condition := cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "Reconciling",
+		Message:            "The operator reconciles the owned objects",
+	}
+	if paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "PausedAnnotation"
+		condition.Message = "The " + cachev1alpha1.PausedAnnotation + " annotation is set, the owned objects are left alone"
+	}
+	status.SetCondition(condition)
+}
+
+// recordPauseTransition emits an event when the given memcached CR enters or leaves the paused
+// state reported in its status.
+func (r *MemcachedReconciler) recordPauseTransition(m *cachev1alpha1.Memcached, paused bool) {
+	if paused == m.Status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		return
+	}
+	if paused {
+		r.Recorder.Event(m, corev1.EventTypeNormal, "Paused", "Paused the reconciliation of the owned objects")
+	} else {
+		r.Recorder.Event(m, corev1.EventTypeNormal, "Resumed", "Resumed the reconciliation of the owned objects")
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedPaused checks that a paused Memcached leaves its hand-edited Deployment alone while
+// its status is still reported, and that the drift is corrected once resumed.
+func TestMemcachedPaused(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	r, cl, recorder := newTestReconciler(memcached)
+	req := requestFor(memcached)
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	getMemcached := func() *cachev1alpha1.Memcached {
+		updated := &cachev1alpha1.Memcached{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+			t.Fatalf("get memcached: (%v)", err)
+		}
+		return updated
+	}
+	update := func(mutate func(*cachev1alpha1.Memcached)) {
+		updated := getMemcached()
+		mutate(updated)
+		if err := cl.Update(context.TODO(), updated); err != nil {
+			t.Fatalf("update memcached: (%v)", err)
+		}
+		reconcileTimes(t, r, req, 1)
+	}
+	reconcileTimes(t, r, req, 2)
+	drainEvents(recorder)
+
+	// Pausing leaves a hand-edited Deployment and spec changes alone.
+	dep := getDeployment()
+	dep.Spec.Template.Spec.Containers[0].Image = "memcached:hotfix"
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 2, AvailableReplicas: 2}
+	if err := cl.Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment: (%v)", err)
+	}
+	update(func(m *cachev1alpha1.Memcached) {
+		m.Annotations = map[string]string{cachev1alpha1.PausedAnnotation: "true"}
+		m.Spec.Size = 4
+	})
+	dep = getDeployment()
+	if image := dep.Spec.Template.Spec.Containers[0].Image; image != "memcached:hotfix" {
+		t.Errorf("paused deployment image (%s) was reverted", image)
+	}
+	if *dep.Spec.Replicas != 3 {
+		t.Errorf("paused deployment size (%d) was scaled", *dep.Spec.Replicas)
+	}
+	expectEvents(t, recorder, "Normal Paused Paused the reconciliation of the owned objects")
+
+	// The status still follows the workload.
+	status := getMemcached().Status
+	if status.ReadyReplicas != 2 {
+		t.Errorf("paused memcached ready replicas (%d) is not the ready replicas of the deployment", status.ReadyReplicas)
+	}
+	if !status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		t.Error("paused memcached has no Paused condition")
+	}
+
+	// Resuming corrects the drift, and the corrected Deployment is observed again before the status
+	// is updated.
+	update(func(m *cachev1alpha1.Memcached) { delete(m.Annotations, cachev1alpha1.PausedAnnotation) })
+	reconcileTimes(t, r, req, 1)
+	dep = getDeployment()
+	if image := dep.Spec.Template.Spec.Containers[0].Image; image == "memcached:hotfix" {
+		t.Error("resumed deployment image was not reverted")
+	}
+	if *dep.Spec.Replicas != 4 {
+		t.Errorf("resumed deployment size (%d) was not scaled to the spec size", *dep.Spec.Replicas)
+	}
+	if getMemcached().Status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		t.Error("resumed memcached is still reported paused")
+	}
+	expectEvents(t, recorder,
+		"Normal Scaled Scaled Deployment memcached-operator from 3 to 4 members",
+		"Normal DriftCorrected Corrected Deployment memcached-operator fields: spec.replicas, spec.template.spec.containers[0].image",
+		"Normal Resumed Resumed the reconciliation of the owned objects",
+	)
+}
@@ -0,0 +1,124 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// reconcilePodDisruptionBudget creates or updates the PodDisruptionBudget of the given memcached CR.
+// A single member cannot be protected without blocking node drains forever, so the budget owned
+// by the CR is deleted while the cluster has fewer than two members.
+func (r *MemcachedReconciler) reconcilePodDisruptionBudget(ctx context.Context, log logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &policyv1beta1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Size < 2 {
+			return nil
+		}
+		pdb := r.podDisruptionBudgetForMemcached(m)
+		log.Info("Creating a new PodDisruptionBudget", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+		if err := r.Create(ctx, pdb); err != nil {
+			return err
+		}
+		recordOperation("PodDisruptionBudget", "create")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created PodDisruptionBudget %s", pdb.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Size < 2 {
+		log.Info("Deleting the PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+		if err := r.Delete(ctx, found); err != nil {
+			return err
+		}
+		recordOperation("PodDisruptionBudget", "delete")
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted PodDisruptionBudget %s", found.Name)
+		return nil
+	}
+
+	desired := r.podDisruptionBudgetForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	log.Info("Updating the PodDisruptionBudget", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+	if err := r.Update(ctx, found); err != nil {
+		return err
+	}
+	recordOperation("PodDisruptionBudget", "update")
+	r.Recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated PodDisruptionBudget %s", found.Name)
+	return nil
+}
+
+// podDisruptionBudgetForMemcached returns a memcached PodDisruptionBudget object
+func (r *MemcachedReconciler) podDisruptionBudgetForMemcached(m *cachev1alpha1.Memcached) *policyv1beta1.PodDisruptionBudget {
+	minAvailable, maxUnavailable := disruptionBudgetForMemcached(m)
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labelsForMemcached(m.Name),
+			},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, pdb, r.Scheme)
+	return pdb
+}
+
+// disruptionBudgetForMemcached returns the minAvailable or maxUnavailable bound of the
+// PodDisruptionBudget of the given memcached CR, defaulting to one unavailable member.
+// A bound that would forbid every eviction is relaxed to let one member go at a time.
+func disruptionBudgetForMemcached(m *cachev1alpha1.Memcached) (*intstr.IntOrString, *intstr.IntOrString) {
+	size := int(m.Spec.Size)
+	one := intstr.FromInt(1)
+	budget := m.Spec.DisruptionBudget
+	switch {
+	case budget != nil && budget.MinAvailable != nil:
+		minAvailable := *budget.MinAvailable
+		if n, err := intstr.GetValueFromIntOrPercent(&minAvailable, size, true); err != nil || n >= size {
+			minAvailable = intstr.FromInt(size - 1)
+		}
+		return &minAvailable, nil
+	case budget != nil && budget.MaxUnavailable != nil:
+		maxUnavailable := *budget.MaxUnavailable
+		if n, err := intstr.GetValueFromIntOrPercent(&maxUnavailable, size, true); err != nil || n < 1 {
+			maxUnavailable = one
+		}
+		return nil, &maxUnavailable
+	}
+	return nil, &one
+}
@@ -0,0 +1,111 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// softAntiAffinityWeight is the weight of the preference for nodes not running another member
+const softAntiAffinityWeight = 100
+
+// addPlacementToPodSpec schedules the memcached pods as the placement of the given memcached CR asks.
+func addPlacementToPodSpec(m *cachev1alpha1.Memcached, spec *corev1.PodSpec) {
+	placement := m.Spec.Placement
+	if placement == nil {
+		return
+	}
+	spec.Affinity = affinityForMemcached(m)
+	spec.TopologySpreadConstraints = topologySpreadConstraintsForMemcached(m)
+	spec.NodeSelector = placement.NodeSelector
+	spec.Tolerations = placement.Tolerations
+	spec.PriorityClassName = placement.PriorityClassName
+}
+
+// affinityForMemcached returns the pod anti-affinity keeping the members of the given memcached CR
+// off the nodes running other members, or nil when they may share nodes.
+func affinityForMemcached(m *cachev1alpha1.Memcached) *corev1.Affinity {
+	term := corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: labelsForMemcached(m.Name)},
+		TopologyKey:   corev1.LabelHostname,
+	}
+	switch m.Spec.Placement.AntiAffinity {
+	case cachev1alpha1.AntiAffinityHard:
+		return &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		}}
+	case cachev1alpha1.AntiAffinitySoft:
+		return &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+				Weight:          softAntiAffinityWeight,
+				PodAffinityTerm: term,
+			}},
+		}}
+	}
+	return nil
+}
+
+// topologySpreadConstraintsForMemcached returns the constraints spreading the members of the
+// given memcached CR across zones and hosts.
+func topologySpreadConstraintsForMemcached(m *cachev1alpha1.Memcached) []corev1.TopologySpreadConstraint {
+	var constraints []corev1.TopologySpreadConstraint
+	for _, spread := range []struct {
+		topologyKey string
+		spread      *cachev1alpha1.TopologySpread
+	}{
+		{corev1.LabelZoneFailureDomainStable, m.Spec.Placement.ZoneSpread},
+		{corev1.LabelHostname, m.Spec.Placement.HostSpread},
+	} {
+		if spread.spread == nil {
+			continue
+		}
+		constraint := corev1.TopologySpreadConstraint{
+			MaxSkew:           spread.spread.MaxSkew,
+			TopologyKey:       spread.topologyKey,
+			WhenUnsatisfiable: spread.spread.WhenUnsatisfiable,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: labelsForMemcached(m.Name)},
+		}
+		if constraint.MaxSkew == 0 {
+			constraint.MaxSkew = 1
+		}
+		if constraint.WhenUnsatisfiable == "" {
+			constraint.WhenUnsatisfiable = corev1.ScheduleAnyway
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+// zonesForMembers counts the given members in each zone, ordered by zone. Members whose zone is
+// unknown, as they are not scheduled yet or their node has no zone label, are not counted.
+func zonesForMembers(members []cachev1alpha1.MemberStatus) []cachev1alpha1.ZoneStatus {
+	counts := map[string]int32{}
+	for _, member := range members {
+		if member.Zone != "" {
+			counts[member.Zone]++
+		}
+	}
+	var zones []cachev1alpha1.ZoneStatus
+	for zone, n := range counts {
+		zones = append(zones, cachev1alpha1.ZoneStatus{Zone: zone, Members: n})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Zone < zones[j].Zone })
+	return zones
+}
@@ -0,0 +1,109 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedPlacement checks that the placement is reflected in the pod template, removed from
+// it with the placement, and that the members are counted per zone.
+func TestMemcachedPlacement(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size: 3,
+			Placement: &cachev1alpha1.Placement{
+				AntiAffinity:      cachev1alpha1.AntiAffinityHard,
+				ZoneSpread:        &cachev1alpha1.TopologySpread{WhenUnsatisfiable: corev1.DoNotSchedule},
+				NodeSelector:      map[string]string{"pool": "cache"},
+				Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "cache"}},
+				PriorityClassName: "cache",
+			},
+		},
+	}
+	objs := []runtime.Object{memcached}
+	for i, zone := range []string{"zone-a", "zone-b", "zone-a"} {
+		node := "node-" + strconv.Itoa(i)
+		objs = append(objs,
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: node, Labels: map[string]string{corev1.LabelZoneFailureDomainStable: zone}}},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: memcached.Name + "-" + strconv.Itoa(i), Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+				Spec:       corev1.PodSpec{NodeName: node},
+			})
+	}
+	objs = append(objs, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: memcached.Name + "-pending", Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+	})
+	r, cl, _ := newTestReconciler(objs...)
+	req := requestFor(memcached)
+	reconcileTimes(t, r, req, 2)
+
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	spec := dep.Spec.Template.Spec
+	if spec.Affinity == nil || spec.Affinity.PodAntiAffinity == nil || len(spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("pod affinity %v does not require members on distinct nodes", spec.Affinity)
+	}
+	expectedSpread := []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelZoneFailureDomainStable,
+		WhenUnsatisfiable: corev1.DoNotSchedule,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: labelsForMemcached(memcached.Name)},
+	}}
+	if !reflect.DeepEqual(spec.TopologySpreadConstraints, expectedSpread) {
+		t.Errorf("topology spread constraints %v are not the expected constraints %v", spec.TopologySpreadConstraints, expectedSpread)
+	}
+	if spec.NodeSelector["pool"] != "cache" || len(spec.Tolerations) != 1 || spec.PriorityClassName != "cache" {
+		t.Errorf("pod spec does not select the cache nodes: nodeSelector %v, tolerations %v, priorityClassName %q",
+			spec.NodeSelector, spec.Tolerations, spec.PriorityClassName)
+	}
+
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	expectedZones := []cachev1alpha1.ZoneStatus{{Zone: "zone-a", Members: 2}, {Zone: "zone-b", Members: 1}}
+	if !reflect.DeepEqual(updated.Status.Zones, expectedZones) {
+		t.Errorf("zones %v are not the expected zones %v", updated.Status.Zones, expectedZones)
+	}
+
+	// Removing the placement lets the members be scheduled anywhere again.
+	updated.Spec.Placement = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	spec = dep.Spec.Template.Spec
+	if spec.Affinity != nil || spec.TopologySpreadConstraints != nil || spec.NodeSelector != nil || spec.Tolerations != nil || spec.PriorityClassName != "" {
+		t.Errorf("pod spec kept the removed placement: %+v", spec)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+const (
+	// configHashAnnotation is the pod template annotation identifying the command of the members
+	// and the data of the Secrets and ConfigMaps mounted into them, so the members are rolled out
+	// again whenever one of them changes, as memcached only reads them on startup
+	configHashAnnotation = "cache.example.com/config-hash"
+	// restartedAtAnnotation is the pod template annotation carrying the restartedAt of the
+	// memcached CR, so setting it to a new time rolls the members
+	restartedAtAnnotation = "cache.example.com/restartedAt"
+)
+
+// annotationsForPodTemplate returns the annotations of the memcached pod template with the given
+// spec, rendered from the given memcached CR and the configuration of its members.
+func annotationsForPodTemplate(m *cachev1alpha1.Memcached, config *podConfig, spec *corev1.PodSpec) map[string]string {
+	annotations := map[string]string{configHashAnnotation: configHash(spec, config.mountedDataHashes())}
+	if m.Spec.RestartedAt != nil {
+		annotations[restartedAtAnnotation] = m.Spec.RestartedAt.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
+
+// mountedDataHashes returns the digests of the data of the Secrets and ConfigMaps mounted into
+// the members, by volume name.
+func (c *podConfig) mountedDataHashes() map[string]string {
+	hashes := map[string]string{}
+	if c.sasl != nil {
+		hashes["sasl"] = c.sasl.hash
+	}
+	if c.tls != nil {
+		hashes["tls"] = c.tls.hash
+	}
+	return hashes
+}
+
+// configHash returns a digest of the command and environment of the memcached container of the
+// given pod spec and of the given digests of the mounted data.
+func configHash(spec *corev1.PodSpec, mounted map[string]string) string {
+	container := spec.Containers[0]
+	// Marshaling the inputs cannot fail, and sorts the mounted data by volume name
+	data, _ := json.Marshal(struct {
+		Command []string          `json:"command"`
+		Env     []corev1.EnvVar   `json:"env"`
+		Mounted map[string]string `json:"mounted"`
+	}{container.Command, container.Env, mounted})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
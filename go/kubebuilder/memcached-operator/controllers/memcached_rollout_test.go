@@ -0,0 +1,91 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedRestart checks that config changes and restart requests roll the members, and that
+// the last restart is reported once rolled out.
+func TestMemcachedRestart(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 1},
+	}
+	r, cl, recorder := newTestReconciler(memcached)
+	req := requestFor(memcached)
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	update := func(mutate func(*cachev1alpha1.Memcached)) {
+		updated := &cachev1alpha1.Memcached{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+			t.Fatalf("get memcached: (%v)", err)
+		}
+		mutate(updated)
+		if err := cl.Update(context.TODO(), updated); err != nil {
+			t.Fatalf("update memcached: (%v)", err)
+		}
+		reconcileTimes(t, r, req, 1)
+	}
+	reconcileTimes(t, r, req, 2)
+	hash := getDeployment().Spec.Template.Annotations[configHashAnnotation]
+	if hash == "" {
+		t.Fatal("pod template has no config hash")
+	}
+
+	// Changing the memcached arguments changes the config hash.
+	threads := int32(8)
+	update(func(m *cachev1alpha1.Memcached) { m.Spec.Config = &cachev1alpha1.Config{Threads: &threads} })
+	if getDeployment().Spec.Template.Annotations[configHashAnnotation] == hash {
+		t.Error("pod template config hash was not updated to the new arguments")
+	}
+
+	// A restart request is passed through to the pod template.
+	restartedAt := metav1.NewTime(time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC))
+	update(func(m *cachev1alpha1.Memcached) { m.Spec.RestartedAt = &restartedAt })
+	dep := getDeployment()
+	if value := dep.Spec.Template.Annotations[restartedAtAnnotation]; value != "2020-04-01T12:00:00Z" {
+		t.Errorf("pod template restartedAt (%s) is not the requested restart time", value)
+	}
+
+	// The restart is reported once the members are rolled out.
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+	if err := cl.Status().Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment status: (%v)", err)
+	}
+	drainEvents(recorder)
+	reconcileTimes(t, r, req, 1)
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !updated.Status.LastRestartTime.Equal(&restartedAt) {
+		t.Errorf("last restart time (%v) is not the requested restart time", updated.Status.LastRestartTime)
+	}
+	expectEvents(t, recorder, "Normal Restarted Restarted every member at 2020-04-01T12:00:00Z")
+}
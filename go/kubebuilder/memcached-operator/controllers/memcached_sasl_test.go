@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedSASL checks that the SASL database is rendered from the valid users of the
+// Memcached, mounted into the pods and rolled out again when a password changes, and that the users
+// report whether they are active.
+func TestMemcachedSASL(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size: 1,
+			Auth: &cachev1alpha1.Auth{SASL: &cachev1alpha1.SASLAuth{Enabled: true}},
+		},
+	}
+	user := func(name, username, secret string) *cachev1alpha1.MemcachedUser {
+		return &cachev1alpha1.MemcachedUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "memcached"},
+			Spec: cachev1alpha1.MemcachedUserSpec{
+				MemcachedName: memcached.Name,
+				Username:      username,
+				PasswordSecret: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  "password",
+				},
+			},
+		}
+	}
+	password := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice-password", Namespace: "memcached"},
+		Data:       map[string][]byte{"password": []byte("s3cret")},
+	}
+	other := user("carol", "", "alice-password")
+	other.Spec.MemcachedName = "other"
+	objs := []runtime.Object{
+		memcached, password, other,
+		user("alice", "", "alice-password"),
+		user("bob", "", "bob-password"),
+		user("operator", operatorUsername, "alice-password"),
+	}
+	r, cl, _ := newTestReconciler(objs...)
+	req := requestFor(memcached)
+	reconcileTimes(t, r, req, 1)
+
+	// Only the valid user referencing the Memcached is added, next to the operator.
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, secret); err != nil {
+		t.Fatalf("get SASL secret: (%v)", err)
+	}
+	operatorPassword := string(secret.Data[saslOperatorPasswordKey])
+	if operatorPassword == "" {
+		t.Fatal("SASL secret has no operator password")
+	}
+	expected := "memcached-operator:" + operatorPassword + "\nalice:s3cret\n"
+	if database := string(secret.Data[saslDatabaseKey]); database != expected {
+		t.Errorf("SASL database %q is not the expected database %q", database, expected)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	container := dep.Spec.Template.Spec.Containers[0]
+	if command := container.Command; command[len(command)-1] != "-S" {
+		t.Errorf("memcached command %v does not enable SASL", command)
+	}
+	expectedHash := configHash(&dep.Spec.Template.Spec, map[string]string{"sasl": saslHash(secret.Data)})
+	if hash := dep.Spec.Template.Annotations[configHashAnnotation]; hash != expectedHash {
+		t.Errorf("pod template config hash (%s) does not match the SASL secret (%s)", hash, expectedHash)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != secret.Name {
+		t.Errorf("pod template volumes %v do not mount the SASL secret", volumes)
+	}
+
+	// Once the members are rolled out the valid user is active.
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+	if err := cl.Status().Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment status: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 2)
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !reflect.DeepEqual(updated.Status.ActiveUsers, []string{"alice"}) {
+		t.Errorf("active users %v are not the expected users [alice]", updated.Status.ActiveUsers)
+	}
+	statuses := map[string]cachev1alpha1.MemcachedUserStatus{
+		"alice":    {Active: true},
+		"bob":      {Message: "Password Secret bob-password not found"},
+		"operator": {Message: "Username memcached-operator is reserved for the operator"},
+		"carol":    {},
+	}
+	for name, status := range statuses {
+		u := &cachev1alpha1.MemcachedUser{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, u); err != nil {
+			t.Fatalf("get user %s: (%v)", name, err)
+		}
+		if u.Status != status {
+			t.Errorf("user %s status %v is not the expected status %v", name, u.Status, status)
+		}
+	}
+
+	// Changing a password updates the database, keeping the operator password, and rolls the members.
+	// The rolled Deployment is observed again before the password resync is scheduled.
+	password.Data["password"] = []byte("changed")
+	if err := cl.Update(context.TODO(), password); err != nil {
+		t.Fatalf("update password: (%v)", err)
+	}
+	if res := reconcileTimes(t, r, req, 2); res.RequeueAfter != secretResyncPeriod {
+		t.Errorf("reconcile requeued after %s instead of the password resync period", res.RequeueAfter)
+	}
+	secret = &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, secret); err != nil {
+		t.Fatalf("get SASL secret: (%v)", err)
+	}
+	expected = "memcached-operator:" + operatorPassword + "\nalice:changed\n"
+	if database := string(secret.Data[saslDatabaseKey]); database != expected {
+		t.Errorf("SASL database %q is not the expected database %q", database, expected)
+	}
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	expectedHash = configHash(&dep.Spec.Template.Spec, map[string]string{"sasl": saslHash(secret.Data)})
+	if hash := dep.Spec.Template.Annotations[configHashAnnotation]; hash != expectedHash {
+		t.Errorf("pod template config hash (%s) was not updated to the SASL secret (%s)", hash, expectedHash)
+	}
+
+	// Disabling SASL removes the database and unmounts it.
+	updated.Spec.Auth = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, &corev1.Secret{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("SASL secret not deleted with SASL disabled: (%v)", err)
+	}
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 0 {
+		t.Errorf("pod template volumes %v still mount the SASL secret", volumes)
+	}
+}
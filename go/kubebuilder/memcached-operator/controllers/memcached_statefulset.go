@@ -0,0 +1,104 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// reconcileStatefulSet creates the memcached StatefulSet or corrects its drift, and returns its rollout state.
+// It returns true when the request must be requeued to observe the StatefulSet after a change.
+func (r *MemcachedReconciler) reconcileStatefulSet(ctx context.Context, log logr.Logger, memcached *cachev1alpha1.Memcached, config *podConfig) (*workloadStatus, bool, error) {
+	// Check if the statefulset already exists, if not create a new one
+	found := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new statefulset
+		sts := r.statefulSetForMemcached(memcached, config)
+		log.Info("Creating a new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		err = r.Create(ctx, sts)
+		if err != nil {
+			log.Error(err, "Failed to create new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create StatefulSet %s: %v", sts.Name, err)
+			return nil, false, err
+		}
+		recordOperation("StatefulSet", "create")
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created StatefulSet %s", sts.Name)
+		// StatefulSet created successfully - return and requeue
+		return nil, true, nil
+	} else if err != nil {
+		log.Error(err, "Failed to get StatefulSet")
+		return nil, false, err
+	}
+
+	// Ensure the statefulset matches the spec, reverting manual edits of the fields the operator manages
+	original := found.DeepCopy()
+	if drift := correctStatefulSetDrift(r.statefulSetForMemcached(memcached, config), found); len(drift) > 0 {
+		log.Info("Correcting StatefulSet drift", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name, "Fields", drift)
+		err = r.Patch(ctx, found, client.MergeFrom(original))
+		if err != nil {
+			log.Error(err, "Failed to patch StatefulSet", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			r.Recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update StatefulSet %s: %v", found.Name, err)
+			return nil, false, err
+		}
+		recordOperation("StatefulSet", "update")
+		recordScale(original.Spec.Replicas, found.Spec.Replicas)
+		r.recordScaleEvent(memcached, "StatefulSet", found.Name, original.Spec.Replicas, found.Spec.Replicas)
+		r.Recorder.Eventf(memcached, corev1.EventTypeNormal, "DriftCorrected", "Corrected StatefulSet %s fields: %s", found.Name, strings.Join(drift, ", "))
+		// Spec updated - return and requeue
+		return nil, true, nil
+	}
+
+	return statefulSetWorkloadStatus(found), false, nil
+}
+
+// statefulSetForMemcached returns a memcached StatefulSet object. Its pods get stable names
+// and DNS records through the governing headless service.
+func (r *MemcachedReconciler) statefulSetForMemcached(m *cachev1alpha1.Memcached, config *podConfig) *appsv1.StatefulSet {
+	ls := labelsForMemcached(m.Name)
+	replicas := m.Spec.Size
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceName(m.Name),
+			// Members do not depend on each other, so they can start and stop together
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ls,
+			},
+			Template: podTemplateForMemcached(m, config),
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	ctrl.SetControllerReference(m, sts, r.Scheme)
+	return sts
+}
@@ -0,0 +1,322 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// TestMemcachedTLS checks that the operator issues and renews the certificates of the members, and
+// that a Secret of the user or disabling TLS replaces them.
+func TestMemcachedTLS(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:    1,
+			Version: "1.6.9",
+			TLS:     &cachev1alpha1.TLS{Enabled: true},
+		},
+	}
+	r, cl, recorder := newTestReconciler(memcached)
+	req := requestFor(memcached)
+	getSecret := func(name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, secret); err != nil {
+			t.Fatalf("get secret %s: (%v)", name, err)
+		}
+		return secret
+	}
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	// verify checks the issued certificate is valid for the Service against the published CA bundle.
+	verify := func(secret *corev1.Secret) *x509.Certificate {
+		bundle := &corev1.ConfigMap{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, bundle); err != nil {
+			t.Fatalf("get CA bundle: (%v)", err)
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM([]byte(bundle.Data[caBundleKey]))
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			t.Fatalf("parse certificate: (%v)", err)
+		}
+		for _, name := range []string{"memcached-operator.memcached.svc", "memcached-operator-0.memcached-operator-headless.memcached.svc.cluster.local"} {
+			if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+				t.Errorf("certificate is not valid for %s: (%v)", name, err)
+			}
+		}
+		return cert
+	}
+
+	// The operator issues a CA and a certificate, and mounts it into the members.
+	reconcileTimes(t, r, req, 1)
+	secret := getSecret(tlsSecretName(memcached.Name))
+	cert := verify(secret)
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity != cachev1alpha1.DefaultCertificateDuration+certificateBackdate {
+		t.Errorf("certificate validity (%s) is not the default duration", validity)
+	}
+	dep := getDeployment()
+	container := dep.Spec.Template.Spec.Containers[0]
+	expected := []string{"-Z", "-o", "ssl_chain_cert=/etc/memcached/tls/tls.crt,ssl_key=/etc/memcached/tls/tls.key"}
+	if command := container.Command; !reflect.DeepEqual(command[len(command)-3:], expected) {
+		t.Errorf("memcached command %v does not enable TLS", command)
+	}
+	hash := configHash(&dep.Spec.Template.Spec, map[string]string{"tls": dataHash(secret.Data, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)})
+	if dep.Spec.Template.Annotations[configHashAnnotation] != hash {
+		t.Errorf("pod template config hash (%s) does not match the TLS secret (%s)", dep.Spec.Template.Annotations[configHashAnnotation], hash)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != secret.Name {
+		t.Errorf("pod template volumes %v do not mount the TLS secret", volumes)
+	}
+
+	// A certificate due for renewal is renewed, rolling the members. The rolled Deployment is observed
+	// again before the secret resync is scheduled.
+	ca, err := parseKeyPair(getSecret(caSecretName(memcached.Name)).Data[corev1.TLSCertKey], getSecret(caSecretName(memcached.Name)).Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatalf("parse CA: (%v)", err)
+	}
+	old, err := issueKeyPair(&x509.Certificate{
+		DNSNames:  dnsNamesForMemcached(memcached),
+		NotBefore: time.Now().Add(-2 * time.Hour),
+		NotAfter:  time.Now().Add(30 * time.Minute),
+	}, ca)
+	if err != nil {
+		t.Fatalf("issue certificate: (%v)", err)
+	}
+	secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey] = old.certPEM, old.keyPEM
+	if err := cl.Update(context.TODO(), secret); err != nil {
+		t.Fatalf("update TLS secret: (%v)", err)
+	}
+	if res := reconcileTimes(t, r, req, 2); res.RequeueAfter != secretResyncPeriod {
+		t.Errorf("reconcile requeued after %s instead of the secret resync period", res.RequeueAfter)
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if cert := verify(secret); cert.SerialNumber.Cmp(old.cert.SerialNumber) == 0 {
+		t.Error("certificate due for renewal was not renewed")
+	}
+	if dep := getDeployment(); dep.Spec.Template.Annotations[configHashAnnotation] == hash {
+		t.Error("pod template config hash was not updated to the renewed certificate")
+	}
+
+	drainEvents(recorder)
+
+	// A CA due for renewal is replaced, keeping the previous CA in the bundle until it expires.
+	oldCA, err := issueKeyPair(&x509.Certificate{
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(30 * time.Minute),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("issue CA: (%v)", err)
+	}
+	caSecret := getSecret(caSecretName(memcached.Name))
+	caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey] = oldCA.certPEM, oldCA.keyPEM
+	if err := cl.Update(context.TODO(), caSecret); err != nil {
+		t.Fatalf("update CA secret: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if cert := verify(secret); cert.CheckSignatureFrom(oldCA.cert) == nil {
+		t.Error("certificate was not reissued by the renewed CA")
+	}
+	if bundle := string(secret.Data[caBundleKey]); !strings.HasSuffix(bundle, string(oldCA.certPEM)) {
+		t.Error("CA bundle does not keep the previous CA")
+	}
+
+	drainEvents(recorder)
+
+	// Switching to a Secret of the user removes the issued certificates and mounts that Secret.
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.TLS.SecretName = "memcached-cert"
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err == nil || !strings.Contains(err.Error(), "TLS Secret memcached-cert not found") {
+		t.Errorf("reconcile did not fail on the missing TLS secret: (%v)", err)
+	}
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-cert", Namespace: "memcached"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: old.certPEM, corev1.TLSPrivateKeyKey: old.keyPEM},
+	}
+	if err := cl.Create(context.TODO(), userSecret); err != nil {
+		t.Fatalf("create TLS secret: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	for _, name := range []string{tlsSecretName(memcached.Name), caSecretName(memcached.Name)} {
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, &corev1.Secret{}); !errors.IsNotFound(err) {
+			t.Errorf("issued secret %s not deleted: (%v)", name, err)
+		}
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("CA bundle not deleted: (%v)", err)
+	}
+	dep = getDeployment()
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != userSecret.Name {
+		t.Errorf("pod template volumes %v do not mount the TLS secret of the user", volumes)
+	}
+
+	drainEvents(recorder)
+
+	// Disabling TLS unmounts the certificate.
+	updated = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.TLS = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTimes(t, r, req, 1)
+	dep = getDeployment()
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 0 {
+		t.Errorf("pod template volumes %v still mount the TLS secret", volumes)
+	}
+	if command := dep.Spec.Template.Spec.Containers[0].Command; reflect.DeepEqual(command[len(command)-3:], expected) {
+		t.Errorf("memcached command %v still enables TLS", command)
+	}
+}
+
+// TestMemcachedCARotation checks that a renewed CA is published in the CA bundle before the
+// certificate of the members is reissued by it.
+func TestMemcachedCARotation(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:    1,
+			Version: "1.6.9",
+			TLS:     &cachev1alpha1.TLS{Enabled: true},
+		},
+	}
+	r, cl, _ := newTestReconciler(memcached)
+	req := requestFor(memcached)
+	getSecret := func(name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, secret); err != nil {
+			t.Fatalf("get secret %s: (%v)", name, err)
+		}
+		return secret
+	}
+	getBundle := func() string {
+		bundle := &corev1.ConfigMap{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, bundle); err != nil {
+			t.Fatalf("get CA bundle: (%v)", err)
+		}
+		return bundle.Data[caBundleKey]
+	}
+	// served reports whether the members are rolled to the certificate of the given TLS secret.
+	served := func(secret *corev1.Secret) bool {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		hash := configHash(&dep.Spec.Template.Spec, map[string]string{"tls": dataHash(secret.Data, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)})
+		return dep.Spec.Template.Annotations[configHashAnnotation] == hash
+	}
+	reconcileTimes(t, r, req, 1)
+
+	// Serve a certificate issued by a CA due for renewal.
+	oldCA, err := issueKeyPair(&x509.Certificate{
+		NotBefore:             time.Now().Add(-3 * time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("issue CA: (%v)", err)
+	}
+	old, err := issueKeyPair(&x509.Certificate{
+		DNSNames:  dnsNamesForMemcached(memcached),
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	}, oldCA)
+	if err != nil {
+		t.Fatalf("issue certificate: (%v)", err)
+	}
+	caSecret := getSecret(caSecretName(memcached.Name))
+	caSecret.Data = map[string][]byte{corev1.TLSCertKey: oldCA.certPEM, corev1.TLSPrivateKeyKey: oldCA.keyPEM}
+	if err := cl.Update(context.TODO(), caSecret); err != nil {
+		t.Fatalf("update CA secret: (%v)", err)
+	}
+	secret := getSecret(tlsSecretName(memcached.Name))
+	secret.Data = map[string][]byte{corev1.TLSCertKey: old.certPEM, corev1.TLSPrivateKeyKey: old.keyPEM, caBundleKey: oldCA.certPEM}
+	if err := cl.Update(context.TODO(), secret); err != nil {
+		t.Fatalf("update TLS secret: (%v)", err)
+	}
+
+	// The renewed CA is published next to the previous one, the certificate is kept.
+	reconcileTimes(t, r, req, 1)
+	ca, err := parseCertificate(getSecret(caSecretName(memcached.Name)).Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatalf("parse CA: (%v)", err)
+	}
+	if ca.Equal(oldCA.cert) {
+		t.Fatal("CA due for renewal was not renewed")
+	}
+	bundle := getBundle()
+	if !strings.HasSuffix(bundle, string(oldCA.certPEM)) || len(bundle) == len(oldCA.certPEM) {
+		t.Errorf("CA bundle does not hold both the renewed and the previous CA")
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if !reflect.DeepEqual(secret.Data[corev1.TLSCertKey], old.certPEM) {
+		t.Error("certificate was reissued before the CA bundle was distributed")
+	}
+	if string(secret.Data[caBundleKey]) != bundle {
+		t.Error("TLS secret does not hold the CA bundle")
+	}
+	if !served(secret) {
+		t.Error("members do not serve the certificate issued by the previous CA")
+	}
+
+	// Once the CA bundle is distributed, the certificate is reissued by the renewed CA.
+	defer func(period time.Duration) { caBundlePropagationPeriod = period }(caBundlePropagationPeriod)
+	caBundlePropagationPeriod = 0
+	reconcileTimes(t, r, req, 1)
+	secret = getSecret(tlsSecretName(memcached.Name))
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatalf("parse certificate: (%v)", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate was not reissued by the renewed CA: (%v)", err)
+	}
+	if !served(secret) {
+		t.Error("members were not rolled to the reissued certificate")
+	}
+}
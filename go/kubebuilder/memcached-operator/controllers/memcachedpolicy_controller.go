@@ -0,0 +1,150 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+)
+
+// MemcachedPolicyReconciler reports the Memcacheds violating a MemcachedPolicy in its status
+type MemcachedPolicyReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=cache.example.com,resources=memcachedpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cache.example.com,resources=memcachedpolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+func (r *MemcachedPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("memcachedpolicy", req.NamespacedName)
+
+	policy := &cachev1alpha1.MemcachedPolicy{}
+	if err := r.Get(ctx, req.NamespacedName, policy); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get MemcachedPolicy")
+		return ctrl.Result{}, err
+	}
+
+	violations, err := r.violationsOfPolicy(ctx, policy)
+	if err != nil {
+		log.Error(err, "Failed to evaluate MemcachedPolicy")
+		return ctrl.Result{}, err
+	}
+
+	status := cachev1alpha1.MemcachedPolicyStatus{
+		Violations:         violations,
+		ObservedGeneration: policy.Generation,
+	}
+	if equality.Semantic.DeepEqual(status, policy.Status) {
+		return ctrl.Result{}, nil
+	}
+	policy.Status = status
+	if err := r.Status().Update(ctx, policy); err != nil {
+		if errors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		log.Error(err, "Failed to update MemcachedPolicy status")
+		return ctrl.Result{}, err
+	}
+	log.Info("Updated MemcachedPolicy violations", "Violations", len(violations))
+	return ctrl.Result{}, nil
+}
+
+// violationsOfPolicy returns the Memcacheds of the namespaces selected by the given policy that
+// violate it, ordered by namespace and name.
+func (r *MemcachedPolicyReconciler) violationsOfPolicy(ctx context.Context, policy *cachev1alpha1.MemcachedPolicy) ([]cachev1alpha1.PolicyViolation, error) {
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	var violations []cachev1alpha1.PolicyViolation
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		selected, err := policy.Selects(ns)
+		if err != nil {
+			return nil, err
+		}
+		if !selected {
+			continue
+		}
+		memcacheds := &cachev1alpha1.MemcachedList{}
+		if err := r.List(ctx, memcacheds, client.InNamespace(ns.Name)); err != nil {
+			return nil, err
+		}
+		for j := range memcacheds.Items {
+			m := &memcacheds.Items[j]
+			errs := policy.Violations(m)
+			if len(errs) == 0 {
+				continue
+			}
+			violation := cachev1alpha1.PolicyViolation{Namespace: m.Namespace, Name: m.Name}
+			for _, err := range errs {
+				violation.Messages = append(violation.Messages, err.Error())
+			}
+			violations = append(violations, violation)
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Namespace != violations[j].Namespace {
+			return violations[i].Namespace < violations[j].Namespace
+		}
+		return violations[i].Name < violations[j].Name
+	})
+	return violations, nil
+}
+
+// policyRequests maps a change of a Memcached or Namespace to a request for every MemcachedPolicy,
+// as any of them may select it.
+func (r *MemcachedPolicyReconciler) policyRequests(handler.MapObject) []reconcile.Request {
+	policies := &cachev1alpha1.MemcachedPolicyList{}
+	if err := r.List(context.Background(), policies); err != nil {
+		r.Log.Error(err, "Failed to list MemcachedPolicies")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(policies.Items))
+	for _, policy := range policies.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+	}
+	return requests
+}
+
+func (r *MemcachedPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	toPolicies := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.policyRequests)}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1alpha1.MemcachedPolicy{}).
+		Watches(&source.Kind{Type: &cachev1alpha1.Memcached{}}, toPolicies).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, toPolicies).
+		Complete(r)
+}
@@ -20,13 +20,17 @@ import (
 	"flag"
 	"os"
 
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	cachev1alpha1 "github.com/example-inc/memcached-operator/api/v1alpha1"
+	cachev1beta1 "github.com/example-inc/memcached-operator/api/v1beta1"
 	"github.com/example-inc/memcached-operator/controllers"
 	// +kubebuilder:scaffold:imports
 )
@@ -34,23 +38,31 @@ import (
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+	// managerLabels are the labels config/manager sets on the manager pods and their namespace
+	managerLabels = map[string]string{"control-plane": "controller-manager"}
 )
 
 func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 
 	_ = cachev1alpha1.AddToScheme(scheme)
+	_ = cachev1beta1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var maxScaleDownStep int
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxScaleDownStep, "max-scale-down-step", int(cachev1alpha1.MaxScaleDownStep),
+		"The most members a single update of a Memcached may remove. "+
+			"Zero lets an update remove any number of members.")
 	flag.Parse()
+	cachev1alpha1.MaxScaleDownStep = int32(maxScaleDownStep)
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
@@ -67,13 +79,29 @@ func main() {
 	}
 
 	if err = (&controllers.MemcachedReconciler{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("Memcached"),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("memcached-controller"),
+		APIReader: mgr.GetAPIReader(),
+		OperatorPeer: &networkingv1.NetworkPolicyPeer{
+			PodSelector:       &metav1.LabelSelector{MatchLabels: managerLabels},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: managerLabels},
+		},
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Memcached")
+		os.Exit(1)
+	}
+	if err = (&controllers.MemcachedPolicyReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Memcached"),
+		Log:    ctrl.Log.WithName("controllers").WithName("MemcachedPolicy"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Memcached")
+		setupLog.Error(err, "unable to create controller", "controller", "MemcachedPolicy")
 		os.Exit(1)
 	}
+	// Export the cache statistics of the memcached members with the controller-runtime metrics
+	metrics.Registry.MustRegister(controllers.NewStatsCollector(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("stats").WithName("Memcached")))
 	if err = (&cachev1alpha1.Memcached{}).SetupWebhookWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Memcached")
 		os.Exit(1)
@@ -0,0 +1,310 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package memcache is a minimal client for the memcached text protocol, covering
+// the commands the operator needs to check on the memcached members. Connections
+// authenticated with SASL speak the binary protocol instead, as memcached only
+// supports SASL over the binary protocol.
+package memcache
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLineLength is the longest text response line read, newline included
+	maxLineLength = 4096
+	// maxStats is the most statistics read from a stats response, so a server that never ends
+	// the response cannot make the client grow the statistics until the command times out
+	maxStats = 1 << 14
+)
+
+// Conn is a connection to a memcached server speaking the text protocol, or the
+// binary protocol once authenticated. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	timeout time.Duration
+	// binary is true once the connection speaks the binary protocol
+	binary bool
+}
+
+// Dial connects to the memcached server at addr. Connecting and every
+// command on the connection give up after timeout.
+func Dial(addr string, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, timeout), nil
+}
+
+// DialTLS connects to the memcached server at addr over TLS with the given
+// configuration. Connecting, including the handshake, and every command on
+// the connection give up after timeout.
+func DialTLS(addr string, timeout time.Duration, config *tls.Config) (*Conn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, timeout), nil
+}
+
+func newConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{
+		conn:    conn,
+		rw:      bufio.NewReadWriter(bufio.NewReaderSize(conn, maxLineLength), bufio.NewWriter(conn)),
+		timeout: timeout,
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Authenticate authenticates the connection with the SASL PLAIN mechanism.
+// The connection speaks the binary protocol from then on.
+func (c *Conn) Authenticate(username, password string) error {
+	c.binary = true
+	value := "\x00" + username + "\x00" + password
+	if err := c.sendBinary(opSASLAuth, "PLAIN", value); err != nil {
+		return err
+	}
+	_, _, err := c.readBinary(opSASLAuth)
+	return err
+}
+
+// Version returns the version reported by the server, e.g. "1.5.20".
+func (c *Conn) Version() (string, error) {
+	if c.binary {
+		if err := c.sendBinary(opVersion, "", ""); err != nil {
+			return "", err
+		}
+		_, version, err := c.readBinary(opVersion)
+		return version, err
+	}
+	if err := c.send("version"); err != nil {
+		return "", err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "VERSION ") {
+		return "", fmt.Errorf("unexpected version response %q", line)
+	}
+	return strings.TrimPrefix(line, "VERSION "), nil
+}
+
+// FlushAll invalidates every item stored on the server.
+func (c *Conn) FlushAll() error {
+	if c.binary {
+		if err := c.sendBinary(opFlush, "", ""); err != nil {
+			return err
+		}
+		_, _, err := c.readBinary(opFlush)
+		return err
+	}
+	if err := c.send("flush_all"); err != nil {
+		return err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "OK" {
+		return fmt.Errorf("unexpected flush_all response %q", line)
+	}
+	return nil
+}
+
+// Stats are the statistics reported by the stats command, keyed by name.
+type Stats map[string]string
+
+// Uint returns the named statistic as an unsigned integer, and false when
+// it is missing or not a number.
+func (s Stats) Uint(name string) (uint64, bool) {
+	v, err := strconv.ParseUint(s[name], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// Stats returns the general-purpose statistics of the server, or the group
+// of statistics named by args, e.g. "slabs".
+func (c *Conn) Stats(args ...string) (Stats, error) {
+	if c.binary {
+		return c.statsBinary(strings.Join(args, " "))
+	}
+	if err := c.send(strings.Join(append([]string{"stats"}, args...), " ")); err != nil {
+		return nil, err
+	}
+	stats := Stats{}
+	for n := 0; ; n++ {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "END" {
+			return stats, nil
+		}
+		if n == maxStats {
+			return nil, fmt.Errorf("stats response exceeds %d statistics", maxStats)
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("unexpected stats response %q", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+}
+
+// send writes a command line to the server.
+func (c *Conn) send(command string) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if _, err := c.rw.WriteString(command + "\r\n"); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readLine reads a response line from the server, turning the protocol
+// error responses into errors. Lines longer than maxLineLength are rejected
+// once the read buffer is full, before reading the rest of them.
+func (c *Conn) readLine() (string, error) {
+	b, err := c.rw.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("response line exceeds %d bytes", maxLineLength)
+	}
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimRight(string(b), "\r\n")
+	switch {
+	case line == "ERROR":
+		return "", errors.New("memcached: unknown command")
+	case strings.HasPrefix(line, "CLIENT_ERROR "), strings.HasPrefix(line, "SERVER_ERROR "):
+		return "", fmt.Errorf("memcached: %s", line)
+	}
+	return line, nil
+}
+
+// Binary protocol opcodes, see https://github.com/memcached/memcached/wiki/BinaryProtocolRevamped
+const (
+	opFlush    = 0x08
+	opVersion  = 0x0b
+	opStat     = 0x10
+	opSASLAuth = 0x21
+)
+
+const (
+	magicRequest  = 0x80
+	magicResponse = 0x81
+	headerLength  = 24
+	// maxBodyLength is the longest binary response body read, so a broken or hostile server
+	// cannot make the client allocate up to the 4 GiB the header allows
+	maxBodyLength = 1 << 20
+)
+
+// statsBinary returns the statistics of the given group, reported in one response per statistic
+// terminated by a response without key.
+func (c *Conn) statsBinary(group string) (Stats, error) {
+	if err := c.sendBinary(opStat, group, ""); err != nil {
+		return nil, err
+	}
+	stats := Stats{}
+	for n := 0; ; n++ {
+		key, value, err := c.readBinary(opStat)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return stats, nil
+		}
+		if n == maxStats {
+			return nil, fmt.Errorf("stats response exceeds %d statistics", maxStats)
+		}
+		stats[key] = value
+	}
+}
+
+// sendBinary writes a binary protocol request without extras to the server.
+func (c *Conn) sendBinary(opcode byte, key, value string) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	header := make([]byte, headerLength)
+	header[0] = magicRequest
+	header[1] = opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(key)))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(key)+len(value)))
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.WriteString(key + value); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readBinary reads a binary protocol response to the given opcode and returns its key and
+// value, turning error statuses into errors.
+func (c *Conn) readBinary(opcode byte) (string, string, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		return "", "", err
+	}
+	if header[0] != magicResponse || header[1] != opcode {
+		return "", "", fmt.Errorf("unexpected binary response header %x", header)
+	}
+	keyLength := int(binary.BigEndian.Uint16(header[2:4]))
+	extrasLength := int(header[4])
+	status := binary.BigEndian.Uint16(header[6:8])
+	bodyLength := binary.BigEndian.Uint32(header[8:12])
+	if bodyLength > maxBodyLength {
+		return "", "", fmt.Errorf("binary response body of %d bytes exceeds %d bytes", bodyLength, maxBodyLength)
+	}
+	body := make([]byte, bodyLength)
+	if keyLength+extrasLength > len(body) {
+		return "", "", fmt.Errorf("malformed binary response header %x", header)
+	}
+	if _, err := io.ReadFull(c.rw, body); err != nil {
+		return "", "", err
+	}
+	key := string(body[extrasLength : extrasLength+keyLength])
+	value := string(body[extrasLength+keyLength:])
+	switch status {
+	case 0:
+		return key, value, nil
+	case 0x20:
+		return "", "", errors.New("memcached: authentication failed")
+	case 0x81:
+		return "", "", errors.New("memcached: unknown command")
+	default:
+		return "", "", fmt.Errorf("memcached: status 0x%02x: %s", status, value)
+	}
+}
@@ -0,0 +1,415 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package memcache
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process memcached server answering each command line
+// with a canned response.
+type fakeServer struct {
+	listener  net.Listener
+	responses map[string]string
+}
+
+// newFakeServer starts a fake server answering the given responses, and
+// ERROR to any other command.
+func newFakeServer(t *testing.T, responses map[string]string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	s := &fakeServer{listener: listener, responses: responses}
+	go s.serve()
+	return s
+}
+
+// newFakeTLSServer starts a fake server like newFakeServer, serving TLS with the given certificate.
+func newFakeTLSServer(t *testing.T, responses map[string]string, cert tls.Certificate) *fakeServer {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	s := &fakeServer{listener: listener, responses: responses}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				response, ok := s.responses[strings.TrimRight(line, "\r\n")]
+				if !ok {
+					response = "ERROR\r\n"
+				}
+				if _, err := conn.Write([]byte(response)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) close() {
+	s.listener.Close()
+}
+
+func TestVersion(t *testing.T) {
+	s := newFakeServer(t, map[string]string{"version": "VERSION 1.5.20\r\n"})
+	defer s.close()
+
+	c, err := Dial(s.addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	version, err := c.Version()
+	if err != nil {
+		t.Fatalf("version: (%v)", err)
+	}
+	if version != "1.5.20" {
+		t.Errorf("version (%s) is not the expected version (1.5.20)", version)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	s := newFakeServer(t, map[string]string{"flush_all": "OK\r\n"})
+	defer s.close()
+
+	c, err := Dial(s.addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if err := c.FlushAll(); err != nil {
+		t.Errorf("flush_all: (%v)", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := newFakeServer(t, map[string]string{
+		"stats":       "STAT pid 1\r\nSTAT uptime 3600\r\nSTAT version 1.5.20\r\nEND\r\n",
+		"stats slabs": "STAT active_slabs 0\r\nSTAT total_malloced 0\r\nEND\r\n",
+	})
+	defer s.close()
+
+	c, err := Dial(s.addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("stats: (%v)", err)
+	}
+	expected := Stats{"pid": "1", "uptime": "3600", "version": "1.5.20"}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("stats %v did not match expected %v", stats, expected)
+	}
+	if uptime, ok := stats.Uint("uptime"); !ok || uptime != 3600 {
+		t.Errorf("uptime (%d, %t) is not the expected (3600, true)", uptime, ok)
+	}
+	if _, ok := stats.Uint("version"); ok {
+		t.Error("non-numeric stat parsed as a number")
+	}
+
+	// A second command on the same connection reads its own response.
+	slabs, err := c.Stats("slabs")
+	if err != nil {
+		t.Fatalf("stats slabs: (%v)", err)
+	}
+	if len(slabs) != 2 {
+		t.Errorf("slab stats %v did not have the expected 2 entries", slabs)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newFakeServer(t, map[string]string{
+		"version":     "SERVER_ERROR out of memory\r\n",
+		"stats":       "garbage\r\n",
+		"stats items": "STAT items:1:number 1\r\n",
+	})
+	defer s.close()
+
+	c, err := Dial(s.addr(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if _, err := c.Version(); err == nil || !strings.Contains(err.Error(), "out of memory") {
+		t.Errorf("server error not returned: (%v)", err)
+	}
+	if _, err := c.Stats("detail"); err == nil {
+		t.Error("unknown command did not return an error")
+	}
+	if _, err := c.Stats(); err == nil {
+		t.Error("malformed stats response did not return an error")
+	}
+	// The response never ends, so the command times out.
+	if _, err := c.Stats("items"); err == nil {
+		t.Error("unterminated stats response did not time out")
+	}
+}
+
+func TestOversizedTextResponse(t *testing.T) {
+	s := newFakeServer(t, map[string]string{
+		"version": "VERSION " + strings.Repeat("1", 2*maxLineLength) + "\r\n",
+		"stats":   strings.Repeat("STAT pid 1\r\n", maxStats+1) + "END\r\n",
+	})
+	defer s.close()
+
+	c, err := Dial(s.addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if _, err := c.Version(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("oversized response line was not rejected: (%v)", err)
+	}
+
+	c, err = Dial(s.addr(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if _, err := c.Stats(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("stats response with too many statistics was not rejected: (%v)", err)
+	}
+}
+
+// serveBinary answers binary protocol requests on conn like a memcached server with SASL
+// enabled, accepting the given credentials.
+func serveBinary(conn net.Conn, username, password string) {
+	defer conn.Close()
+	authenticated := false
+	for {
+		header := make([]byte, headerLength)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		keyLength := binary.BigEndian.Uint16(header[2:4])
+		body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		key, value := string(body[:keyLength]), string(body[keyLength:])
+		respond := func(status uint16, key, value string) {
+			response := make([]byte, headerLength)
+			response[0] = magicResponse
+			response[1] = header[1]
+			binary.BigEndian.PutUint16(response[2:4], uint16(len(key)))
+			binary.BigEndian.PutUint16(response[6:8], status)
+			binary.BigEndian.PutUint32(response[8:12], uint32(len(key)+len(value)))
+			conn.Write(append(response, key+value...))
+		}
+		switch {
+		case header[1] == opSASLAuth:
+			authenticated = key == "PLAIN" && value == "\x00"+username+"\x00"+password
+			if !authenticated {
+				respond(0x20, "", "Auth failure")
+				continue
+			}
+			respond(0, "", "Authenticated")
+		case !authenticated:
+			respond(0x20, "", "Auth failure")
+		case header[1] == opVersion:
+			respond(0, "", "1.5.20")
+		case header[1] == opFlush:
+			respond(0, "", "")
+		case header[1] == opStat && key == "":
+			respond(0, "pid", "1")
+			respond(0, "uptime", "3600")
+			respond(0, "", "")
+		default:
+			respond(0x81, "", "Unknown command")
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveBinary(conn, "operator", "secret")
+		}
+	}()
+
+	c, err := Dial(listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if err := c.Authenticate("operator", "wrong"); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("wrong password did not fail authentication: (%v)", err)
+	}
+	if err := c.Authenticate("operator", "secret"); err != nil {
+		t.Fatalf("authenticate: (%v)", err)
+	}
+	version, err := c.Version()
+	if err != nil {
+		t.Fatalf("version: (%v)", err)
+	}
+	if version != "1.5.20" {
+		t.Errorf("version (%s) is not the expected version (1.5.20)", version)
+	}
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("stats: (%v)", err)
+	}
+	expected := Stats{"pid": "1", "uptime": "3600"}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("stats %v did not match expected %v", stats, expected)
+	}
+	if err := c.FlushAll(); err != nil {
+		t.Errorf("flush_all: (%v)", err)
+	}
+	if _, err := c.Stats("slabs"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("unknown stats group did not return an error: (%v)", err)
+	}
+}
+
+func TestOversizedBinaryResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Answer the authentication with a header announcing a 2 GiB body, without sending it
+		request := make([]byte, headerLength)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		response := make([]byte, headerLength)
+		response[0] = magicResponse
+		response[1] = request[1]
+		binary.BigEndian.PutUint32(response[8:12], 1<<31)
+		conn.Write(response)
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	c, err := Dial(listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	if err := c.Authenticate("operator", "secret"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("oversized response body was not rejected: (%v)", err)
+	}
+}
+
+// selfSignedCertificate returns a certificate for 127.0.0.1 signed by itself, and a pool trusting it.
+func selfSignedCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: (%v)", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "memcached"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: (%v)", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: (%v)", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, pool := selfSignedCertificate(t)
+	s := newFakeTLSServer(t, map[string]string{"version": "VERSION 1.5.20\r\n"}, cert)
+	defer s.close()
+
+	c, err := DialTLS(s.addr(), time.Second, &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatalf("dial: (%v)", err)
+	}
+	defer c.Close()
+	version, err := c.Version()
+	if err != nil {
+		t.Fatalf("version: (%v)", err)
+	}
+	if version != "1.5.20" {
+		t.Errorf("version (%s) is not the expected version (1.5.20)", version)
+	}
+
+	if _, err := DialTLS(s.addr(), time.Second, &tls.Config{RootCAs: x509.NewCertPool()}); err == nil {
+		t.Error("dial to a server with an untrusted certificate did not return an error")
+	}
+}
+
+func TestDialUnreachable(t *testing.T) {
+	s := newFakeServer(t, nil)
+	addr := s.addr()
+	s.close()
+
+	if _, err := Dial(addr, 100*time.Millisecond); err == nil {
+		t.Error("dial to a closed server did not return an error")
+	}
+}
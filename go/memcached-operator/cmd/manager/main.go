@@ -15,6 +15,7 @@ import (
 
 	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis"
 	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/controller"
+	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/controller/memcached"
 	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -31,6 +32,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 // Change below variables to serve metrics on different host or port.
@@ -128,6 +130,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Export the cache statistics of the memcached members on the metrics port
+	crmetrics.Registry.MustRegister(memcached.NewStatsCollector(mgr.GetClient(), mgr.GetAPIReader(), logf.Log.WithName("stats")))
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg)
 
@@ -0,0 +1,81 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported in MemcachedStatus.Conditions
+const (
+	// ConditionAvailable means every desired memcached member is available
+	ConditionAvailable = "Available"
+	// ConditionProgressing means the memcached members are being created, scaled or rolled out
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded means the memcached cluster failed to reach its desired state
+	ConditionDegraded = "Degraded"
+	// ConditionPaused means the operator leaves the objects owned by the Memcached alone,
+	// only reporting their state, as the paused annotation is set
+	ConditionPaused = "Paused"
+)
+
+// Condition describes one aspect of the current state of a Memcached.
+// It has the same shape as metav1.Condition so clients such as
+// "kubectl wait --for=condition=Available" can consume it.
+type Condition struct {
+	// Type of the condition, e.g. Available, Progressing or Degraded
+	Type string `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown
+	Status metav1.ConditionStatus `json:"status"`
+
+	// ObservedGeneration is the .metadata.generation the condition was set based upon
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastTransitionTime is the last time the condition changed from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// Reason is a programmatic identifier for the condition's last transition
+	Reason string `json:"reason"`
+
+	// Message is a human readable description of the transition
+	Message string `json:"message"`
+}
+
+// FindCondition returns the condition of the given type, or nil if it is not set.
+func (s *MemcachedStatus) FindCondition(conditionType string) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition of the same type. LastTransitionTime
+// is only moved when the status changes, or set to now when it is missing.
+func (s *MemcachedStatus) SetCondition(c Condition) {
+	existing := s.FindCondition(c.Type)
+	if existing == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, c)
+		return
+	}
+	if existing.Status != c.Status {
+		existing.Status = c.Status
+		existing.LastTransitionTime = c.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = c.Reason
+	existing.Message = c.Message
+	existing.ObservedGeneration = c.ObservedGeneration
+}
+
+// IsConditionTrue reports whether the condition of the given type is set and True.
+func (s *MemcachedStatus) IsConditionTrue(conditionType string) bool {
+	c := s.FindCondition(conditionType)
+	return c != nil && c.Status == metav1.ConditionTrue
+}
@@ -0,0 +1,70 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MemcachedUserSpec defines the SASL credentials of a client of a Memcached
+type MemcachedUserSpec struct {
+	// MemcachedName is the name of the Memcached, in the same namespace, the user authenticates to
+	// +kubebuilder:validation:MinLength=1
+	MemcachedName string `json:"memcachedName"`
+
+	// Username is the SASL username, the name of the MemcachedUser when omitted
+	// +kubebuilder:validation:Pattern=`^[^:\s]+$`
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// PasswordSecret selects the key of a Secret, in the same namespace, holding the password.
+	// Updating the password rolls the members of the Memcached.
+	PasswordSecret corev1.SecretKeySelector `json:"passwordSecret"`
+}
+
+// MemcachedUserStatus defines the observed state of MemcachedUser
+type MemcachedUserStatus struct {
+	// Active tells whether the members of the Memcached accept the credentials of the user
+	Active bool `json:"active"`
+
+	// Message explains why the user is not active
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MemcachedUser is the Schema for the memcachedusers API. The members of the Memcached it
+// references accept its credentials when SASL authentication is enabled.
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Memcached",type=string,JSONPath=`.spec.memcachedName`
+// +kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.spec.username`
+// +kubebuilder:printcolumn:name="Active",type=boolean,JSONPath=`.status.active`
+// +kubebuilder:resource:path=memcachedusers,scope=Namespaced
+type MemcachedUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MemcachedUserSpec   `json:"spec,omitempty"`
+	Status MemcachedUserStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MemcachedUserList contains a list of MemcachedUser
+type MemcachedUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MemcachedUser `json:"items"`
+}
+
+// SASLUsername returns the username the user authenticates with.
+func (u *MemcachedUser) SASLUsername() string {
+	if u.Spec.Username != "" {
+		return u.Spec.Username
+	}
+	return u.Name
+}
+
+func init() {
+	SchemeBuilder.Register(&MemcachedUser{}, &MemcachedUserList{})
+}
@@ -0,0 +1,198 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// connectionAddressKey is the key of the connection info holding the host:port of the Service
+	connectionAddressKey = "address"
+	// connectionMembersKey is the key of the connection info holding the host:port of each ready
+	// member, ordered by name and separated by commas
+	connectionMembersKey = "members"
+	// connectionProtocolKey is the key of the connection info holding the protocol clients speak
+	connectionProtocolKey = "protocol"
+	// connectionTLSKey is the key of the connection info telling whether the members serve TLS only
+	connectionTLSKey = "tls"
+	// connectionServerNameKey is the key of the connection info holding the name the certificate
+	// of the members is verified for
+	connectionServerNameKey = "serverName"
+)
+
+// connectionInfoName returns the name of the ConfigMap or Secret publishing the connection info of
+// the given memcached CR name.
+func connectionInfoName(name string) string {
+	return name + "-connection"
+}
+
+// reconcileConnectionInfo publishes how clients connect to the given members of the given memcached
+// CR, in a ConfigMap, or in a Secret when SASL is enabled so clients mount it with their credentials.
+// It returns the reference to the object for the status.
+func (r *ReconcileMemcached) reconcileConnectionInfo(reqLogger logr.Logger, m *cachev1alpha1.Memcached, members []cachev1alpha1.MemberStatus, config *podConfig) (*cachev1alpha1.ConnectionInfoReference, error) {
+	secret, configMap := &corev1.Secret{}, &corev1.ConfigMap{}
+	secretExists, err := r.getConnectionInfo(m, secret)
+	if err != nil {
+		return nil, err
+	}
+	configMapExists, err := r.getConnectionInfo(m, configMap)
+	if err != nil {
+		return nil, err
+	}
+	data := connectionInfoData(m, members, config)
+	meta := metav1.ObjectMeta{
+		Name:      connectionInfoName(m.Name),
+		Namespace: m.Namespace,
+		Labels:    connectionInfoObjectLabels(m),
+	}
+
+	// Move the connection info to the other kind when SASL is enabled or disabled
+	if m.Spec.SASLEnabled() {
+		if configMapExists {
+			if err := r.deleteConnectionInfoObject(reqLogger, m, "ConfigMap", configMap); err != nil {
+				return nil, err
+			}
+		}
+		secretData := map[string][]byte{}
+		for key, value := range data {
+			secretData[key] = []byte(value)
+		}
+		ref := &cachev1alpha1.ConnectionInfoReference{Kind: "Secret", Name: meta.Name}
+		if secretExists && reflect.DeepEqual(secret.Data, secretData) {
+			return ref, nil
+		}
+		if !secretExists {
+			secret.ObjectMeta = meta
+			// Set Memcached instance as the owner of the Secret.
+			controllerutil.SetControllerReference(m, secret, r.scheme)
+		}
+		secret.Data = secretData
+		return ref, r.writeConnectionInfo(reqLogger, m, "Secret", secret, secretExists)
+	}
+
+	if secretExists {
+		if err := r.deleteConnectionInfoObject(reqLogger, m, "Secret", secret); err != nil {
+			return nil, err
+		}
+	}
+	ref := &cachev1alpha1.ConnectionInfoReference{Kind: "ConfigMap", Name: meta.Name}
+	if configMapExists && reflect.DeepEqual(configMap.Data, data) {
+		return ref, nil
+	}
+	if !configMapExists {
+		configMap.ObjectMeta = meta
+		// Set Memcached instance as the owner of the ConfigMap.
+		controllerutil.SetControllerReference(m, configMap, r.scheme)
+	}
+	configMap.Data = data
+	return ref, r.writeConnectionInfo(reqLogger, m, "ConfigMap", configMap, configMapExists)
+}
+
+// getConnectionInfo reads the connection info object of the given memcached CR into obj, a Secret
+// or a ConfigMap, from the API server. It reports whether the object exists, and fails when it is
+// not owned by the CR.
+func (r *ReconcileMemcached) getConnectionInfo(m *cachev1alpha1.Memcached, obj interface {
+	metav1.Object
+	runtime.Object
+}) (bool, error) {
+	err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: connectionInfoName(m.Name), Namespace: m.Namespace}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !metav1.IsControlledBy(obj, m) {
+		return false, fmt.Errorf("%s already exists and is not owned by the Memcached", obj.GetName())
+	}
+	return true, nil
+}
+
+// writeConnectionInfo creates the given connection info object of the given memcached CR, or
+// updates it when it exists.
+func (r *ReconcileMemcached) writeConnectionInfo(reqLogger logr.Logger, m *cachev1alpha1.Memcached, kind string, obj interface {
+	metav1.Object
+	runtime.Object
+}, exists bool) error {
+	if !exists {
+		reqLogger.Info("Creating new connection info.", kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+		if err := r.client.Create(context.TODO(), obj); err != nil {
+			return err
+		}
+		recordOperation(kind, "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created connection info %s %s", kind, obj.GetName())
+		return nil
+	}
+	reqLogger.Info("Updating the connection info.", kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+	if err := r.client.Update(context.TODO(), obj); err != nil {
+		return err
+	}
+	recordOperation(kind, "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated connection info %s %s", kind, obj.GetName())
+	return nil
+}
+
+// connectionInfoObjectLabels returns the labels of the connection info object of the given
+// memcached CR, so the teardown finds it.
+func connectionInfoObjectLabels(m *cachev1alpha1.Memcached) map[string]string {
+	labels := labelsForMemcached(m.Name)
+	for key, value := range connectionInfoLabels(m) {
+		labels[key] = value
+	}
+	return labels
+}
+
+// connectionInfoData returns the connection info of the given memcached CR with the given members
+// and configuration.
+func connectionInfoData(m *cachev1alpha1.Memcached, members []cachev1alpha1.MemberStatus, config *podConfig) map[string]string {
+	protocol := "ascii"
+	// memcached only supports SASL over the binary protocol
+	if config.sasl != nil {
+		protocol = "binary"
+	}
+	data := map[string]string{
+		connectionAddressKey:  net.JoinHostPort(serviceDNSName(m), "11211"),
+		connectionMembersKey:  strings.Join(memberEndpoints(m, members), ","),
+		connectionProtocolKey: protocol,
+		connectionTLSKey:      strconv.FormatBool(config.tls != nil),
+	}
+	if config.tls != nil {
+		data[connectionServerNameKey] = serviceDNSName(m)
+		if len(config.tls.caBundle) > 0 {
+			data[caBundleKey] = string(config.tls.caBundle)
+		}
+	}
+	return data
+}
+
+// memberEndpoints returns the host:port of each ready member of the given memcached CR, in the
+// order of the given members. StatefulSet members are addressed by their stable DNS name behind
+// the headless Service, the others by their pod IP.
+func memberEndpoints(m *cachev1alpha1.Memcached, members []cachev1alpha1.MemberStatus) []string {
+	var endpoints []string
+	for _, member := range members {
+		if !member.Ready || member.PodIP == "" {
+			continue
+		}
+		host := member.PodIP
+		if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+			host = member.Name + "." + headlessServiceName(m.Name) + "." + m.Namespace + ".svc"
+		}
+		endpoints = append(endpoints, net.JoinHostPort(host, "11211"))
+	}
+	return endpoints
+}
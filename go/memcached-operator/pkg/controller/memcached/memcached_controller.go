@@ -3,15 +3,24 @@ package memcached
 import (
 	"context"
 	"reflect"
+	"strings"
+	"time"
 
 	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
 
+	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -32,7 +41,12 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileMemcached{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileMemcached{
+		client:    mgr.GetClient(),
+		scheme:    mgr.GetScheme(),
+		recorder:  mgr.GetEventRecorderFor("memcached-controller"),
+		apiReader: mgr.GetAPIReader(),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -59,6 +73,14 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	err = c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &cachev1alpha1.Memcached{},
+	})
+	if err != nil {
+		return err
+	}
+
 	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
 		OwnerType:    &cachev1alpha1.Memcached{},
@@ -67,6 +89,38 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	err = c.Watch(&source.Kind{Type: &policyv1beta1.PodDisruptionBudget{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &cachev1alpha1.Memcached{},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &autoscalingv2beta2.HorizontalPodAutoscaler{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &cachev1alpha1.Memcached{},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &networkingv1.NetworkPolicy{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &cachev1alpha1.Memcached{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Render the SASL database again when the users referencing a Memcached change
+	err = c.Watch(&source.Kind{Type: &cachev1alpha1.MemcachedUser{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(memcachedForUser),
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -77,8 +131,11 @@ type ReconcileMemcached struct {
 	// TODO: Clarify the split client
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// apiReader reads objects the reconciler does not watch directly from the apiserver
+	apiReader client.Reader
 }
 
 // Reconcile reads that state of the cluster for a Memcached object and makes changes based on the state read
@@ -98,9 +155,10 @@ func (r *ReconcileMemcached) Reconcile(request reconcile.Request) (reconcile.Res
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, the teardown already ran on deletion.
 			// Return and don't requeue
 			reqLogger.Info("Memcached resource not found. Ignoring since object must be deleted.")
+			deleteReplicasMetric(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -108,40 +166,201 @@ func (r *ReconcileMemcached) Reconcile(request reconcile.Request) (reconcile.Res
 		return reconcile.Result{}, err
 	}
 
-	// Check if the Deployment already exists, if not create a new one
-	deployment := &appsv1.Deployment{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, deployment)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new Deployment
-		dep := r.deploymentForMemcached(memcached)
-		reqLogger.Info("Creating a new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
-		err = r.client.Create(context.TODO(), dep)
+	// Tear down a deleted Memcached before releasing it, otherwise hold it with a finalizer
+	if memcached.GetDeletionTimestamp() != nil {
+		return r.finalizeMemcached(reqLogger, memcached)
+	}
+	if !hasFinalizer(memcached) {
+		controllerutil.AddFinalizer(memcached, memcachedFinalizer)
+		if err := r.client.Update(context.TODO(), memcached); err != nil {
+			reqLogger.Error(err, "Failed to add finalizer.")
+			return reconcile.Result{}, err
+		}
+	}
+	r.recordSpecWarnings(memcached)
+
+	// Leave the owned objects alone while the Memcached is paused, only reporting their state
+	paused := memcached.IsPaused()
+	var members *memberState
+	if paused {
+		members, err = r.observeMembers(reqLogger, memcached)
 		if err != nil {
-			reqLogger.Error(err, "Failed to create new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			reqLogger.Error(err, "Failed to observe paused Memcached.")
 			return reconcile.Result{}, err
 		}
-		// Deployment created successfully - return and requeue
-		// NOTE: that the requeue is made with the purpose to provide the deployment object for the next step to ensure the deployment size is the same as the spec.
-		// Also, you could GET the deployment object again instead of requeue if you wish. See more over it here: https://godoc.org/sigs.k8s.io/controller-runtime/pkg/reconcile#Reconciler
-		return reconcile.Result{Requeue: true}, nil
-	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Deployment.")
+	} else {
+		var requeue bool
+		members, requeue, err = r.reconcileMembers(reqLogger, memcached)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if requeue {
+			return reconcile.Result{Requeue: true}, nil
+		}
+	}
+	workload := members.workload
+
+	// Update the Memcached status with the pod names
+	phaseStart := time.Now()
+	// List the pods for this memcached's workload
+	podList := &corev1.PodList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(memcached.Namespace),
+		client.MatchingLabels(labelsForMemcached(memcached.Name)),
+	}
+	err = r.client.List(context.TODO(), podList, listOpts...)
+	if err != nil {
+		reqLogger.Error(err, "Failed to list pods.", "Memcached.Namespace", memcached.Namespace, "Memcached.Name", memcached.Name)
 		return reconcile.Result{}, err
 	}
+	podNames := getPodNames(podList.Items)
+
+	status := memcached.Status.DeepCopy()
+	status.Nodes = podNames
+	status.Members = r.membersForPods(context.TODO(), podList.Items)
+	status.Zones = zonesForMembers(status.Members)
 
-	// Ensure the deployment size is the same as the spec
-	size := memcached.Spec.Size
-	if *deployment.Spec.Replicas != size {
-		deployment.Spec.Replicas = &size
-		err = r.client.Update(context.TODO(), deployment)
+	// Publish how clients connect to the members, which a paused Memcached leaves as it is
+	if !paused {
+		ref, err := r.reconcileConnectionInfo(reqLogger, memcached, status.Members, members.config)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+			reqLogger.Error(err, "Failed to reconcile connection info.")
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile connection info: %v", err)
 			return reconcile.Result{}, err
 		}
+		status.ConnectionInfo = ref
+	}
+
+	// Check the members answer memcached requests when probing is enabled
+	probeAfter := probeMembers(reqLogger, memcached, status.Members, members.dialer)
+
+	// Track the rollout of the requested version and users, which paused members do not follow
+	version := versionForMemcached(memcached)
+	if workload.rolledOut && !paused {
+		status.CurrentVersion = version
+		status.ActiveUsers = nil
+		if members.config.sasl != nil {
+			status.ActiveUsers = members.config.sasl.users
+		}
+		if restartedAt := memcached.Spec.RestartedAt; restartedAt != nil && !restartedAt.Equal(status.LastRestartTime) {
+			status.LastRestartTime = restartedAt.DeepCopy()
+			r.recorder.Eventf(memcached, corev1.EventTypeNormal, "Restarted", "Restarted every member at %s", restartedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	status.TargetVersion = ""
+	if status.CurrentVersion != version {
+		status.TargetVersion = version
+	}
+
+	// Derive the replica counts and conditions from the workload
+	status.ObservedGeneration = memcached.Generation
+	status.Replicas = workload.currentReplicas
+	status.ReadyReplicas = workload.readyReplicas
+	status.Selector = labels.SelectorFromSet(labelsForMemcached(memcached.Name)).String()
+	setConditions(status, workload, memcached.Generation)
+	setMembersDegraded(status, memcached.Generation)
+	setPausedCondition(status, paused, memcached.Generation)
+	r.recordPauseTransition(memcached, paused)
+	setReplicasMetric(memcached.Namespace, memcached.Name, workload.replicas, workload.readyReplicas)
+
+	// Update status if needed
+	if !reflect.DeepEqual(*status, memcached.Status) {
+		memcached.Status = *status
+		err := r.client.Status().Update(context.TODO(), memcached)
+		if err != nil {
+			if errors.IsConflict(err) {
+				// The Memcached changed since it was read, reconcile it again
+				statusUpdateConflictsTotal.Inc()
+				reqLogger.Info("Memcached status update conflicted, requeueing.")
+				return reconcile.Result{Requeue: true}, nil
+			}
+			reqLogger.Error(err, "Failed to update Memcached status.")
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "StatusUpdateFailed", "Failed to update status: %v", err)
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Report whether the members accept each user
+	if err := r.updateUserStatuses(reqLogger, memcached, members.users, memcached.Status.ActiveUsers); err != nil {
+		reqLogger.Error(err, "Failed to update MemcachedUser status.")
+		return reconcile.Result{}, err
+	}
+	observePhase("status", phaseStart)
+
+	// Requeue to probe the members again once they are due, and to read the Secrets they mount again
+	requeueAfter := probeAfter
+	if config := members.config; config != nil && (config.sasl != nil || config.tls != nil) && (requeueAfter == 0 || requeueAfter > secretResyncPeriod) {
+		requeueAfter = secretResyncPeriod
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// memberState is the state of the members of a memcached CR its status is reported from
+type memberState struct {
+	// config is the configuration the members are rendered with, nil while the CR is paused
+	config *podConfig
+	// users are the SASL users of the CR, nil while the CR is paused
+	users []saslUser
+	// workload is the rollout state of the workload running the members
+	workload *workloadStatus
+	// dialer connects the operator to the members
+	dialer *memberDialer
+}
+
+// reconcileMembers creates or updates every object owned by the given memcached CR, and returns
+// the state of its members. It returns true when the request must be requeued to observe the
+// workload after a change.
+func (r *ReconcileMemcached) reconcileMembers(reqLogger logr.Logger, memcached *cachev1alpha1.Memcached) (*memberState, bool, error) {
+	// Render the SASL database from the users of the Memcached when SASL is enabled
+	phaseStart := time.Now()
+	sasl, users, err := r.reconcileSASL(reqLogger, memcached)
+	if err != nil {
+		reqLogger.Error(err, "Failed to reconcile SASL Secret.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile SASL Secret: %v", err)
+		return nil, false, err
+	}
+	observePhase("auth", phaseStart)
+
+	// Issue or read the certificate the members serve when TLS is enabled
+	phaseStart = time.Now()
+	tls, err := r.reconcileTLS(reqLogger, memcached)
+	if err != nil {
+		reqLogger.Error(err, "Failed to reconcile TLS certificates.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile TLS certificates: %v", err)
+		return nil, false, err
+	}
+	config := &podConfig{sasl: sasl, tls: tls}
+	observePhase("tls", phaseStart)
+
+	// Reconcile the Deployment or StatefulSet running the memcached pods
+	phaseStart = time.Now()
+	var workload *workloadStatus
+	var requeue bool
+	if memcached.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		workload, requeue, err = r.reconcileStatefulSet(reqLogger, memcached, config)
+	} else {
+		workload, requeue, err = r.reconcileDeployment(reqLogger, memcached, config)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	observePhase("workload", phaseStart)
+	if requeue {
+		return nil, true, nil
+	}
+
+	// After a workload type switch, remove the previous workload once the new one is rolled out
+	if workload.rolledOut {
+		if err := r.deleteInactiveWorkload(reqLogger, memcached); err != nil {
+			reqLogger.Error(err, "Failed to delete inactive workload.")
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to delete inactive workload: %v", err)
+			return nil, false, err
+		}
 	}
 
 	// Check if the Service already exists, if not create a new one
 	// NOTE: The Service is used to expose the Deployment. However, the Service is not required at all for the memcached example to work. The purpose is to add more examples of what you can do in your operator project.
+	phaseStart = time.Now()
 	service := &corev1.Service{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, service)
 	if err != nil && errors.IsNotFound(err) {
@@ -151,42 +370,106 @@ func (r *ReconcileMemcached) Reconcile(request reconcile.Request) (reconcile.Res
 		err = r.client.Create(context.TODO(), ser)
 		if err != nil {
 			reqLogger.Error(err, "Failed to create new Service.", "Service.Namespace", ser.Namespace, "Service.Name", ser.Name)
-			return reconcile.Result{}, err
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create Service %s: %v", ser.Name, err)
+			return nil, false, err
 		}
+		recordOperation("Service", "create")
+		r.recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created Service %s", ser.Name)
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Service.")
-		return reconcile.Result{}, err
+		return nil, false, err
+	} else if err := r.patchServiceDrift(reqLogger, memcached, r.serviceForMemcached(memcached), service); err != nil {
+		reqLogger.Error(err, "Failed to patch Service.", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update Service %s: %v", service.Name, err)
+		return nil, false, err
 	}
 
-	// Update the Memcached status with the pod names
-	// List the pods for this memcached's deployment
-	podList := &corev1.PodList{}
-	listOpts := []client.ListOption{
-		client.InNamespace(memcached.Namespace),
-		client.MatchingLabels(labelsForMemcached(memcached.Name)),
+	// Create or remove the headless Service publishing a DNS record per member
+	if err := r.reconcileHeadlessService(reqLogger, memcached); err != nil {
+		reqLogger.Error(err, "Failed to reconcile headless Service.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile headless Service: %v", err)
+		return nil, false, err
 	}
-	err = r.client.List(context.TODO(), podList, listOpts...)
-	if err != nil {
-		reqLogger.Error(err, "Failed to list pods.", "Memcached.Namespace", memcached.Namespace, "Memcached.Name", memcached.Name)
-		return reconcile.Result{}, err
+	observePhase("services", phaseStart)
+
+	// Limit the members voluntary disruptions may evict at once
+	phaseStart = time.Now()
+	if err := r.reconcilePodDisruptionBudget(reqLogger, memcached); err != nil {
+		reqLogger.Error(err, "Failed to reconcile PodDisruptionBudget.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile PodDisruptionBudget: %v", err)
+		return nil, false, err
 	}
-	podNames := getPodNames(podList.Items)
+	observePhase("disruption_budget", phaseStart)
 
-	// Update status.Nodes if needed
-	if !reflect.DeepEqual(podNames, memcached.Status.Nodes) {
-		memcached.Status.Nodes = podNames
-		err := r.client.Status().Update(context.TODO(), memcached)
+	// Only admit the selected clients when access is restricted
+	phaseStart = time.Now()
+	if err := r.reconcileNetworkPolicy(reqLogger, memcached); err != nil {
+		reqLogger.Error(err, "Failed to reconcile NetworkPolicy.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile NetworkPolicy: %v", err)
+		return nil, false, err
+	}
+	observePhase("network_policy", phaseStart)
+
+	// Let the autoscaler choose the size when autoscaling is enabled
+	phaseStart = time.Now()
+	if err := r.reconcileHorizontalPodAutoscaler(reqLogger, memcached); err != nil {
+		reqLogger.Error(err, "Failed to reconcile HorizontalPodAutoscaler.")
+		r.recorder.Eventf(memcached, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile HorizontalPodAutoscaler: %v", err)
+		return nil, false, err
+	}
+	observePhase("autoscaler", phaseStart)
+
+	return &memberState{config: config, users: users, workload: workload, dialer: config.dialer()}, false, nil
+}
+
+// reconcileDeployment creates the memcached Deployment or corrects its drift, and returns its rollout state.
+// It returns true when the request must be requeued to observe the Deployment after a change.
+func (r *ReconcileMemcached) reconcileDeployment(reqLogger logr.Logger, memcached *cachev1alpha1.Memcached, config *podConfig) (*workloadStatus, bool, error) {
+	// Check if the Deployment already exists, if not create a new one
+	deployment := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, deployment)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new Deployment
+		dep := r.deploymentForMemcached(memcached, config)
+		reqLogger.Info("Creating a new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		err = r.client.Create(context.TODO(), dep)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update Memcached status.")
-			return reconcile.Result{}, err
+			reqLogger.Error(err, "Failed to create new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create Deployment %s: %v", dep.Name, err)
+			return nil, false, err
+		}
+		recordOperation("Deployment", "create")
+		r.recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created Deployment %s", dep.Name)
+		// Deployment created successfully - return and requeue
+		// NOTE: that the requeue is made with the purpose to provide the deployment object for the next step to ensure the deployment size is the same as the spec.
+		// Also, you could GET the deployment object again instead of requeue if you wish. See more over it here: https://godoc.org/sigs.k8s.io/controller-runtime/pkg/reconcile#Reconciler
+		return nil, true, nil
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get Deployment.")
+		return nil, false, err
+	}
+
+	// Ensure the Deployment matches the spec, reverting manual edits of the fields the operator manages
+	original := deployment.DeepCopy()
+	if drift := correctDeploymentDrift(r.deploymentForMemcached(memcached, config), deployment); len(drift) > 0 {
+		reqLogger.Info("Correcting Deployment drift.", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name, "Fields", drift)
+		err = r.client.Patch(context.TODO(), deployment, client.MergeFrom(original))
+		if err != nil {
+			reqLogger.Error(err, "Failed to patch Deployment.", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update Deployment %s: %v", deployment.Name, err)
+			return nil, false, err
 		}
+		recordOperation("Deployment", "update")
+		recordScale(original.Spec.Replicas, deployment.Spec.Replicas)
+		r.recordScaleEvent(memcached, "Deployment", deployment.Name, original.Spec.Replicas, deployment.Spec.Replicas)
+		r.recorder.Eventf(memcached, corev1.EventTypeNormal, "DriftCorrected", "Corrected Deployment %s fields: %s", deployment.Name, strings.Join(drift, ", "))
 	}
 
-	return reconcile.Result{}, nil
+	return deploymentWorkloadStatus(deployment), false, nil
 }
 
 // deploymentForMemcached returns a memcached Deployment object
-func (r *ReconcileMemcached) deploymentForMemcached(m *cachev1alpha1.Memcached) *appsv1.Deployment {
+func (r *ReconcileMemcached) deploymentForMemcached(m *cachev1alpha1.Memcached, config *podConfig) *appsv1.Deployment {
 	ls := labelsForMemcached(m.Name)
 	replicas := m.Spec.Size
 
@@ -200,22 +483,7 @@ func (r *ReconcileMemcached) deploymentForMemcached(m *cachev1alpha1.Memcached)
 			Selector: &metav1.LabelSelector{
 				MatchLabels: ls,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image:   "memcached:1.4.36-alpine",
-						Name:    "memcached",
-						Command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 11211,
-							Name:          "memcached",
-						}},
-					}},
-				},
-			},
+			Template: podTemplateForMemcached(m, config),
 		},
 	}
 	// Set Memcached instance as the owner of the Deployment.
@@ -223,6 +491,57 @@ func (r *ReconcileMemcached) deploymentForMemcached(m *cachev1alpha1.Memcached)
 	return dep
 }
 
+// podConfig is the configuration of the members rendered from other objects than the memcached CR
+type podConfig struct {
+	// sasl is the SASL database the members authenticate clients with, nil when SASL is disabled
+	sasl *saslConfig
+	// tls is the certificate the members serve, nil when TLS is disabled
+	tls *tlsConfig
+}
+
+// dialer returns the dialer connecting the operator to the members configured with c.
+func (c *podConfig) dialer() *memberDialer {
+	dialer := &memberDialer{}
+	if c.sasl != nil {
+		dialer.credentials = c.sasl.credentials
+	}
+	if c.tls != nil {
+		dialer.tlsConfig = c.tls.clientConfig
+	}
+	return dialer
+}
+
+// podTemplateForMemcached returns the memcached pod template shared by the Deployment and StatefulSet
+func podTemplateForMemcached(m *cachev1alpha1.Memcached, config *podConfig) corev1.PodTemplateSpec {
+	ls := labelsForMemcached(m.Name)
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: ls,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image:     imageForMemcached(m),
+				Name:      "memcached",
+				Command:   commandForMemcached(m),
+				Resources: resourcesForMemcached(m),
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: 11211,
+					Name:          "memcached",
+				}},
+			}},
+		},
+	}
+	if config.sasl != nil {
+		addSASLToPodSpec(m, &template.Spec)
+	}
+	if config.tls != nil {
+		addTLSToPodSpec(m, &template.Spec)
+	}
+	addPlacementToPodSpec(m, &template.Spec)
+	template.Annotations = annotationsForPodTemplate(m, config, &template.Spec)
+	return template
+}
+
 // serviceForMemcached function takes in a Memcached object and returns a Service for that object.
 func (r *ReconcileMemcached) serviceForMemcached(m *cachev1alpha1.Memcached) *corev1.Service {
 	ls := labelsForMemcached(m.Name)
@@ -246,6 +565,135 @@ func (r *ReconcileMemcached) serviceForMemcached(m *cachev1alpha1.Memcached) *co
 	return ser
 }
 
+// reconcileHeadlessService creates the headless Service of the given memcached CR when it is
+// enabled in the spec, and deletes the one owned by the CR when it is not.
+func (r *ReconcileMemcached) reconcileHeadlessService(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	service := &corev1.Service{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: headlessServiceName(m.Name), Namespace: m.Namespace}, service)
+	if err != nil && errors.IsNotFound(err) {
+		if !headlessServiceEnabled(m) {
+			return nil
+		}
+		ser := r.headlessServiceForMemcached(m)
+		reqLogger.Info("Creating a new headless Service.", "Service.Namespace", ser.Namespace, "Service.Name", ser.Name)
+		if err := r.client.Create(context.TODO(), ser); err != nil {
+			return err
+		}
+		recordOperation("Service", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created headless Service %s", ser.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !headlessServiceEnabled(m) && metav1.IsControlledBy(service, m) {
+		reqLogger.Info("Deleting the headless Service.", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		if err := r.client.Delete(context.TODO(), service); err != nil {
+			return err
+		}
+		recordOperation("Service", "delete")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted headless Service %s", service.Name)
+		return nil
+	}
+	if headlessServiceEnabled(m) && metav1.IsControlledBy(service, m) {
+		return r.patchServiceDrift(reqLogger, m, r.headlessServiceForMemcached(m), service)
+	}
+	return nil
+}
+
+// patchServiceDrift reverts manual edits of the fields the operator manages on the given Service
+// of the given memcached CR.
+func (r *ReconcileMemcached) patchServiceDrift(reqLogger logr.Logger, m *cachev1alpha1.Memcached, desired, service *corev1.Service) error {
+	original := service.DeepCopy()
+	drift := correctServiceDrift(desired, service)
+	if len(drift) == 0 {
+		return nil
+	}
+	reqLogger.Info("Correcting Service drift.", "Service.Namespace", service.Namespace, "Service.Name", service.Name, "Fields", drift)
+	if err := r.client.Patch(context.TODO(), service, client.MergeFrom(original)); err != nil {
+		return err
+	}
+	recordOperation("Service", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "DriftCorrected", "Corrected Service %s fields: %s", service.Name, strings.Join(drift, ", "))
+	return nil
+}
+
+// headlessServiceForMemcached function takes in a Memcached object and returns a headless Service
+// resolving to the individual memcached pods.
+func (r *ReconcileMemcached) headlessServiceForMemcached(m *cachev1alpha1.Memcached) *corev1.Service {
+	ls := labelsForMemcached(m.Name)
+	ser := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(m.Name),
+			Namespace: m.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  ls,
+			Ports: []corev1.ServicePort{
+				{
+					Port: 11211,
+					Name: "memcached",
+				},
+			},
+		},
+	}
+	// Set Memcached instance as the owner of the Service.
+	controllerutil.SetControllerReference(m, ser, r.scheme)
+	return ser
+}
+
+// headlessServiceEnabled reports whether the given memcached CR needs a headless Service,
+// either because it is requested or because it governs the StatefulSet.
+func headlessServiceEnabled(m *cachev1alpha1.Memcached) bool {
+	return m.Spec.HeadlessService || m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet
+}
+
+// headlessServiceName returns the name of the headless Service of the given memcached CR name.
+func headlessServiceName(name string) string {
+	return name + "-headless"
+}
+
+// imageForMemcached returns the memcached container image reference for the given memcached CR.
+func imageForMemcached(m *cachev1alpha1.Memcached) string {
+	image := m.Spec.Image
+	if image == "" {
+		image = cachev1alpha1.DefaultImage
+	}
+	return image + ":" + versionForMemcached(m)
+}
+
+// resourcesForMemcached returns the memcached container resource requirements for the given memcached CR.
+// Memory requests and limits not set in the spec are sized to the cache plus its overhead.
+func resourcesForMemcached(m *cachev1alpha1.Memcached) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{}
+	if m.Spec.Resources != nil {
+		m.Spec.Resources.DeepCopyInto(&resources)
+	}
+	cacheMB := m.Spec.CacheMemoryMB()
+	memory := *resource.NewQuantity((cacheMB+cachev1alpha1.MemoryOverheadMB(cacheMB))*1024*1024, resource.BinarySI)
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if _, ok := resources.Limits[corev1.ResourceMemory]; !ok {
+		resources.Limits[corev1.ResourceMemory] = memory
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	if _, ok := resources.Requests[corev1.ResourceMemory]; !ok {
+		resources.Requests[corev1.ResourceMemory] = resources.Limits[corev1.ResourceMemory]
+	}
+	return resources
+}
+
+// versionForMemcached returns the memcached version requested by the given memcached CR.
+func versionForMemcached(m *cachev1alpha1.Memcached) string {
+	if m.Spec.Version == "" {
+		return cachev1alpha1.DefaultVersion
+	}
+	return m.Spec.Version
+}
+
 // labelsForMemcached returns the labels for selecting the resources
 // belonging to the given memcached CR name.
 func labelsForMemcached(name string) map[string]string {
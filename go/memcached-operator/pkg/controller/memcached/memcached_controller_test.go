@@ -1,21 +1,37 @@
 package memcached
 
 import (
+	"bufio"
 	"context"
+	"crypto/x509"
 	"math/rand"
+	"net"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
@@ -49,11 +65,12 @@ func TestMemcachedController(t *testing.T) {
 
 	// Register operator types with the runtime scheme.
 	s := scheme.Scheme
-	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached)
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
 	// Create a fake client to mock API calls.
 	cl := fake.NewFakeClient(objs...)
 	// Create a ReconcileMemcached object with the scheme and fake client.
-	r := &ReconcileMemcached{client: cl, scheme: s}
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: recorder}
 
 	// Mock request to simulate Reconcile() being called on an event for a
 	// watched resource .
@@ -82,6 +99,14 @@ func TestMemcachedController(t *testing.T) {
 	if dsize != replicas {
 		t.Errorf("dep size (%d) is not the expected size (%d)", dsize, replicas)
 	}
+	// Check the cache size and the container memory sized around it.
+	container := dep.Spec.Template.Spec.Containers[0]
+	if container.Command[1] != "-m=64" {
+		t.Errorf("memcached command %v does not set the default cache size", container.Command)
+	}
+	if limit := container.Resources.Limits[corev1.ResourceMemory]; limit.String() != "96Mi" {
+		t.Errorf("memory limit (%s) is not the expected limit (96Mi)", limit.String())
+	}
 
 	res, err = r.Reconcile(req)
 	if err != nil {
@@ -139,4 +164,1823 @@ func TestMemcachedController(t *testing.T) {
 	if !reflect.DeepEqual(podNames, nodes) {
 		t.Errorf("pod names %v did not match expected %v", nodes, podNames)
 	}
+
+	// Ensure every pod is reported as a member, ordered by name.
+	members := memcached.Status.Members
+	if len(members) != len(podNames) {
+		t.Fatalf("members %v did not match the %d pods", members, len(podNames))
+	}
+	for i := 1; i < len(members); i++ {
+		if members[i-1].Name >= members[i].Name {
+			t.Errorf("members %v are not ordered by name", members)
+		}
+	}
+
+	// The fake Deployment never becomes available, so it must still be progressing.
+	if memcached.Status.IsConditionTrue(cachev1alpha1.ConditionAvailable) {
+		t.Error("memcached is Available before its Deployment has available replicas")
+	}
+	if !memcached.Status.IsConditionTrue(cachev1alpha1.ConditionProgressing) {
+		t.Error("memcached is not Progressing while its Deployment rolls out")
+	}
+
+	// Check the events recorded for the objects created so far.
+	expectEvents(t, recorder,
+		"Normal Created Created Deployment memcached-operator",
+		"Normal Created Created Service memcached-operator",
+		"Normal Created Created PodDisruptionBudget memcached-operator",
+		"Normal Created Created connection info ConfigMap memcached-operator-connection",
+	)
+
+	// Resize the cluster to an even size in a new generation, the Deployment is
+	// scaled and the spec problem is reported.
+	memcached.Generation = 2
+	memcached.Spec.Size = 4
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	expectEvents(t, recorder,
+		"Warning InvalidSpec Cluster size 4 is not an odd number",
+		"Normal Scaled Scaled Deployment memcached-operator from 3 to 4 members",
+		"Normal DriftCorrected Corrected Deployment memcached-operator fields: spec.replicas",
+	)
+}
+
+// expectEvents checks that the recorder holds exactly the given events, in order.
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+	t.Helper()
+	for _, want := range expected {
+		select {
+		case got := <-recorder.Events:
+			if got != want {
+				t.Errorf("event %q is not the expected event %q", got, want)
+			}
+		default:
+			t.Errorf("expected event %q was not recorded", want)
+		}
+	}
+	select {
+	case got := <-recorder.Events:
+		t.Errorf("unexpected event %q", got)
+	default:
+	}
+}
+
+// TestCorrectDeploymentDrift checks that server-defaulted fields are not
+// reported as drift while manual edits are reverted.
+func TestCorrectDeploymentDrift(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	r := &ReconcileMemcached{scheme: scheme.Scheme}
+	desired := r.deploymentForMemcached(memcached, &podConfig{})
+
+	// Fields defaulted by the API server are not drift.
+	actual := desired.DeepCopy()
+	actual.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	actual.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	actual.Spec.Template.Spec.Containers[0].Ports[0].Protocol = corev1.ProtocolTCP
+	actual.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = "now"
+	if drift := correctDeploymentDrift(desired, actual); len(drift) != 0 {
+		t.Errorf("server-defaulted fields reported as drift: %v", drift)
+	}
+
+	// Manual edits are reported and reverted.
+	actual.Spec.Template.Spec.Containers[0].Image = "memcached:latest"
+	actual.Spec.Template.Spec.Containers[0].Ports = append(actual.Spec.Template.Spec.Containers[0].Ports, corev1.ContainerPort{ContainerPort: 11212})
+	actual.Spec.Template.Labels["app"] = "edited"
+	expected := []string{
+		"spec.template.metadata.labels",
+		"spec.template.spec.containers[0].image",
+		"spec.template.spec.containers[0].ports",
+	}
+	if drift := correctDeploymentDrift(desired, actual); !reflect.DeepEqual(drift, expected) {
+		t.Errorf("drift %v did not match expected %v", drift, expected)
+	}
+	if drift := correctDeploymentDrift(desired, actual); len(drift) != 0 {
+		t.Errorf("drift %v was not corrected", drift)
+	}
+}
+
+// TestCommandForMemcached checks that every config field is rendered as its
+// memcached flag, in a stable order.
+func TestCommandForMemcached(t *testing.T) {
+	int32Ptr := func(n int32) *int32 { return &n }
+	boolPtr := func(b bool) *bool { return &b }
+	itemSize := resource.MustParse("2Mi")
+	tests := []struct {
+		name    string
+		config  *cachev1alpha1.Config
+		command []string
+	}{
+		{
+			name:    "no config",
+			command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
+		},
+		{
+			name:    "threads",
+			config:  &cachev1alpha1.Config{Threads: int32Ptr(8)},
+			command: []string{"memcached", "-m=64", "-t", "8", "-o", "modern", "-v"},
+		},
+		{
+			name:    "max connections",
+			config:  &cachev1alpha1.Config{MaxConnections: int32Ptr(4096)},
+			command: []string{"memcached", "-m=64", "-c", "4096", "-o", "modern", "-v"},
+		},
+		{
+			name:    "max item size",
+			config:  &cachev1alpha1.Config{MaxItemSize: &itemSize},
+			command: []string{"memcached", "-m=64", "-I", "2097152", "-o", "modern", "-v"},
+		},
+		{
+			name:    "listen backlog",
+			config:  &cachev1alpha1.Config{ListenBacklog: int32Ptr(2048)},
+			command: []string{"memcached", "-m=64", "-b", "2048", "-o", "modern", "-v"},
+		},
+		{
+			name:    "LRU crawler disabled",
+			config:  &cachev1alpha1.Config{LRUCrawler: boolPtr(false)},
+			command: []string{"memcached", "-m=64", "-o", "modern,no_lru_crawler", "-v"},
+		},
+		{
+			name:    "LRU maintainer enabled",
+			config:  &cachev1alpha1.Config{LRUMaintainer: boolPtr(true)},
+			command: []string{"memcached", "-m=64", "-o", "modern,lru_maintainer", "-v"},
+		},
+		{
+			name:    "LRU percentages",
+			config:  &cachev1alpha1.Config{HotLRUPercent: int32Ptr(10), WarmLRUPercent: int32Ptr(50)},
+			command: []string{"memcached", "-m=64", "-o", "modern,hot_lru_pct=10,warm_lru_pct=50", "-v"},
+		},
+		{
+			name:    "slab automove",
+			config:  &cachev1alpha1.Config{SlabAutomove: int32Ptr(2), SlabAutomoveWindow: int32Ptr(60)},
+			command: []string{"memcached", "-m=64", "-o", "modern,slab_automove=2,slab_automove_window=60", "-v"},
+		},
+		{
+			name: "extended options sorted, reserved ones dropped",
+			config: &cachev1alpha1.Config{ExtendedOptions: map[string]string{
+				"watcher_logbuf_size": "256", "no_hashexpand": "", "modern": "", "ssl_key": "/tmp/key",
+			}},
+			command: []string{"memcached", "-m=64", "-o", "modern,no_hashexpand,watcher_logbuf_size=256", "-v"},
+		},
+		{
+			name: "every flag",
+			config: &cachev1alpha1.Config{
+				Threads:            int32Ptr(4),
+				MaxConnections:     int32Ptr(1024),
+				MaxItemSize:        &itemSize,
+				ListenBacklog:      int32Ptr(512),
+				LRUCrawler:         boolPtr(true),
+				LRUMaintainer:      boolPtr(true),
+				HotLRUPercent:      int32Ptr(20),
+				WarmLRUPercent:     int32Ptr(40),
+				SlabAutomove:       int32Ptr(1),
+				SlabAutomoveWindow: int32Ptr(30),
+				ExtendedOptions:    map[string]string{"tail_repair_time": "0"},
+			},
+			command: []string{"memcached", "-m=64", "-t", "4", "-c", "1024", "-I", "2097152", "-b", "512", "-o",
+				"modern,lru_crawler,lru_maintainer,hot_lru_pct=20,warm_lru_pct=40,slab_automove=1,slab_automove_window=30,tail_repair_time=0", "-v"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &cachev1alpha1.Memcached{Spec: cachev1alpha1.MemcachedSpec{Size: 1, Config: tt.config}}
+			if command := commandForMemcached(m); !reflect.DeepEqual(command, tt.command) {
+				t.Errorf("command %v is not the expected command %v", command, tt.command)
+			}
+		})
+	}
+}
+
+// TestMemcachedRestart checks that config changes and restart requests roll
+// the members, and that the last restart is reported once rolled out.
+func TestMemcachedRestart(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 1},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	recorder := record.NewFakeRecorder(20)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	update := func(mutate func(*cachev1alpha1.Memcached)) {
+		updated := &cachev1alpha1.Memcached{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+			t.Fatalf("get memcached: (%v)", err)
+		}
+		mutate(updated)
+		if err := cl.Update(context.TODO(), updated); err != nil {
+			t.Fatalf("update memcached: (%v)", err)
+		}
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	hash := getDeployment().Spec.Template.Annotations[configHashAnnotation]
+	if hash == "" {
+		t.Fatal("pod template has no config hash")
+	}
+
+	// Changing the memcached arguments changes the config hash.
+	threads := int32(8)
+	update(func(m *cachev1alpha1.Memcached) { m.Spec.Config = &cachev1alpha1.Config{Threads: &threads} })
+	if getDeployment().Spec.Template.Annotations[configHashAnnotation] == hash {
+		t.Error("pod template config hash was not updated to the new arguments")
+	}
+
+	// A restart request is passed through to the pod template.
+	restartedAt := metav1.NewTime(time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC))
+	update(func(m *cachev1alpha1.Memcached) { m.Spec.RestartedAt = &restartedAt })
+	dep := getDeployment()
+	if value := dep.Spec.Template.Annotations[restartedAtAnnotation]; value != "2020-04-01T12:00:00Z" {
+		t.Errorf("pod template restartedAt (%s) is not the requested restart time", value)
+	}
+
+	// The restart is reported once the members are rolled out.
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+	if err := cl.Status().Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment status: (%v)", err)
+	}
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !updated.Status.LastRestartTime.Equal(&restartedAt) {
+		t.Errorf("last restart time (%v) is not the requested restart time", updated.Status.LastRestartTime)
+	}
+	expectEvents(t, recorder, "Normal Restarted Restarted every member at 2020-04-01T12:00:00Z")
+}
+
+// TestMemcachedPaused checks that a paused Memcached leaves its hand-edited
+// Deployment alone while its status is still reported, and that the drift is
+// corrected once resumed.
+func TestMemcachedPaused(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	recorder := record.NewFakeRecorder(20)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	getMemcached := func() *cachev1alpha1.Memcached {
+		updated := &cachev1alpha1.Memcached{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+			t.Fatalf("get memcached: (%v)", err)
+		}
+		return updated
+	}
+	update := func(mutate func(*cachev1alpha1.Memcached)) {
+		updated := getMemcached()
+		mutate(updated)
+		if err := cl.Update(context.TODO(), updated); err != nil {
+			t.Fatalf("update memcached: (%v)", err)
+		}
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// Pausing leaves a hand-edited Deployment and spec changes alone.
+	dep := getDeployment()
+	dep.Spec.Template.Spec.Containers[0].Image = "memcached:hotfix"
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 2, AvailableReplicas: 2}
+	if err := cl.Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment: (%v)", err)
+	}
+	update(func(m *cachev1alpha1.Memcached) {
+		m.Annotations = map[string]string{cachev1alpha1.PausedAnnotation: "true"}
+		m.Spec.Size = 4
+	})
+	dep = getDeployment()
+	if image := dep.Spec.Template.Spec.Containers[0].Image; image != "memcached:hotfix" {
+		t.Errorf("paused deployment image (%s) was reverted", image)
+	}
+	if *dep.Spec.Replicas != 3 {
+		t.Errorf("paused deployment size (%d) was scaled", *dep.Spec.Replicas)
+	}
+	expectEvents(t, recorder, "Normal Paused Paused the reconciliation of the owned objects")
+
+	// The status still follows the workload.
+	status := getMemcached().Status
+	if status.ReadyReplicas != 2 {
+		t.Errorf("paused memcached ready replicas (%d) is not the ready replicas of the deployment", status.ReadyReplicas)
+	}
+	if !status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		t.Error("paused memcached has no Paused condition")
+	}
+
+	// Resuming corrects the drift.
+	update(func(m *cachev1alpha1.Memcached) { delete(m.Annotations, cachev1alpha1.PausedAnnotation) })
+	dep = getDeployment()
+	if image := dep.Spec.Template.Spec.Containers[0].Image; image == "memcached:hotfix" {
+		t.Error("resumed deployment image was not reverted")
+	}
+	if *dep.Spec.Replicas != 4 {
+		t.Errorf("resumed deployment size (%d) was not scaled to the spec size", *dep.Spec.Replicas)
+	}
+	if getMemcached().Status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		t.Error("resumed memcached is still reported paused")
+	}
+	expectEvents(t, recorder,
+		"Normal Scaled Scaled Deployment memcached-operator from 3 to 4 members",
+		"Normal DriftCorrected Corrected Deployment memcached-operator fields: spec.replicas, spec.template.spec.containers[0].image",
+		"Normal Resumed Resumed the reconciliation of the owned objects",
+	)
+}
+
+// TestMemcachedServices checks that the Service and the headless Service
+// select the members, and that their drift is corrected.
+func TestMemcachedServices(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3, HeadlessService: true},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	headlessKey := types.NamespacedName{Name: headlessServiceName(memcached.Name), Namespace: memcached.Namespace}
+
+	// The first pass creates the Deployment, the second the Services.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	expectEvents(t, recorder,
+		"Normal Created Created Deployment memcached-operator",
+		"Normal Created Created Service memcached-operator",
+		"Normal Created Created headless Service memcached-operator-headless",
+		"Normal Created Created PodDisruptionBudget memcached-operator",
+		"Normal Created Created connection info ConfigMap memcached-operator-connection",
+	)
+
+	headless := &corev1.Service{}
+	if err := cl.Get(context.TODO(), headlessKey, headless); err != nil {
+		t.Fatalf("get headless service: (%v)", err)
+	}
+	if headless.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Errorf("headless service has cluster IP %q", headless.Spec.ClusterIP)
+	}
+	if !reflect.DeepEqual(headless.Spec.Selector, labelsForMemcached(memcached.Name)) {
+		t.Errorf("headless service selects %v instead of the memcached pods", headless.Spec.Selector)
+	}
+	ports := []corev1.ServicePort{{Name: "memcached", Port: 11211}}
+	if !reflect.DeepEqual(headless.Spec.Ports, ports) {
+		t.Errorf("headless service ports %v are not the expected ports %v", headless.Spec.Ports, ports)
+	}
+	if owner := metav1.GetControllerOf(headless); owner == nil || owner.Kind != "Memcached" || owner.Name != memcached.Name {
+		t.Errorf("headless service is controlled by %v instead of the memcached", owner)
+	}
+
+	// Edits of the managed fields are reverted, the fields defaulted by the API server are kept.
+	service := &corev1.Service{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, service); err != nil {
+		t.Fatalf("get service: (%v)", err)
+	}
+	service.Spec.ClusterIP = "10.0.0.10"
+	service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Name: "extra", Port: 8080})
+	if err := cl.Update(context.TODO(), service); err != nil {
+		t.Fatalf("update service: (%v)", err)
+	}
+	headless.Spec.Selector = map[string]string{"app": "other"}
+	headless.Spec.Ports[0].Protocol = corev1.ProtocolTCP
+	headless.Spec.Ports[0].TargetPort = intstr.FromInt(11211)
+	if err := cl.Update(context.TODO(), headless); err != nil {
+		t.Fatalf("update headless service: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	expectEvents(t, recorder,
+		"Normal DriftCorrected Corrected Service memcached-operator fields: spec.ports",
+		"Normal DriftCorrected Corrected Service memcached-operator-headless fields: spec.selector",
+	)
+	if err := cl.Get(context.TODO(), req.NamespacedName, service); err != nil {
+		t.Fatalf("get service: (%v)", err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.ClusterIP != "10.0.0.10" {
+		t.Errorf("service drift was not corrected: ports %v, cluster IP %q", service.Spec.Ports, service.Spec.ClusterIP)
+	}
+	if err := cl.Get(context.TODO(), headlessKey, headless); err != nil {
+		t.Fatalf("get headless service: (%v)", err)
+	}
+	if !reflect.DeepEqual(headless.Spec.Selector, labelsForMemcached(memcached.Name)) {
+		t.Errorf("headless service selector %v was not corrected", headless.Spec.Selector)
+	}
+	if headless.Spec.Ports[0].Protocol != corev1.ProtocolTCP {
+		t.Errorf("headless service port %v lost its defaulted protocol", headless.Spec.Ports[0])
+	}
+
+	// Disabling the headless Service deletes it.
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	memcached.Spec.HeadlessService = false
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), headlessKey, headless); !errors.IsNotFound(err) {
+		t.Errorf("headless service not deleted: (%v)", err)
+	}
+	expectEvents(t, recorder, "Normal Deleted Deleted headless Service memcached-operator-headless")
+}
+
+// TestMemcachedStatefulSet checks that the StatefulSet workload mode creates
+// a StatefulSet governed by the headless Service instead of a Deployment.
+func TestMemcachedStatefulSet(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:         3,
+			WorkloadType: cachev1alpha1.WorkloadTypeStatefulSet,
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+
+	// The first pass creates the StatefulSet, the second the Services.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, sts); err != nil {
+		t.Fatalf("get statefulset: (%v)", err)
+	}
+	if sts.Spec.ServiceName != headlessServiceName(memcached.Name) {
+		t.Errorf("statefulset service name (%s) is not the headless service (%s)", sts.Spec.ServiceName, headlessServiceName(memcached.Name))
+	}
+	headless := &corev1.Service{}
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: headlessServiceName(memcached.Name), Namespace: memcached.Namespace}, headless)
+	if err != nil {
+		t.Fatalf("get headless service: (%v)", err)
+	}
+	if headless.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Errorf("headless service has cluster IP %q", headless.Spec.ClusterIP)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, &appsv1.Deployment{}); err == nil {
+		t.Error("deployment created in StatefulSet mode")
+	}
+}
+
+// TestMemcachedSASL checks that the SASL database is rendered from the valid
+// users of the Memcached, mounted into the pods and rolled out again when a
+// password changes, and that the users report whether they are active.
+func TestMemcachedSASL(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size: 1,
+			Auth: &cachev1alpha1.Auth{SASL: &cachev1alpha1.SASLAuth{Enabled: true}},
+		},
+	}
+	user := func(name, username, secret string) *cachev1alpha1.MemcachedUser {
+		return &cachev1alpha1.MemcachedUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "memcached"},
+			Spec: cachev1alpha1.MemcachedUserSpec{
+				MemcachedName: memcached.Name,
+				Username:      username,
+				PasswordSecret: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  "password",
+				},
+			},
+		}
+	}
+	password := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice-password", Namespace: "memcached"},
+		Data:       map[string][]byte{"password": []byte("s3cret")},
+	}
+	other := user("carol", "", "alice-password")
+	other.Spec.MemcachedName = "other"
+	objs := []runtime.Object{
+		memcached, password, other,
+		user("alice", "", "alice-password"),
+		user("bob", "", "bob-password"),
+		user("operator", operatorUsername, "alice-password"),
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(objs...)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(100)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	// Only the valid user referencing the Memcached is added, next to the operator.
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, secret); err != nil {
+		t.Fatalf("get SASL secret: (%v)", err)
+	}
+	operatorPassword := string(secret.Data[saslOperatorPasswordKey])
+	if operatorPassword == "" {
+		t.Fatal("SASL secret has no operator password")
+	}
+	expected := "memcached-operator:" + operatorPassword + "\nalice:s3cret\n"
+	if database := string(secret.Data[saslDatabaseKey]); database != expected {
+		t.Errorf("SASL database %q is not the expected database %q", database, expected)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	container := dep.Spec.Template.Spec.Containers[0]
+	if command := container.Command; command[len(command)-1] != "-S" {
+		t.Errorf("memcached command %v does not enable SASL", command)
+	}
+	expectedHash := configHash(&dep.Spec.Template.Spec, map[string]string{"sasl": saslHash(secret.Data)})
+	if hash := dep.Spec.Template.Annotations[configHashAnnotation]; hash != expectedHash {
+		t.Errorf("pod template config hash (%s) does not match the SASL secret (%s)", hash, expectedHash)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != secret.Name {
+		t.Errorf("pod template volumes %v do not mount the SASL secret", volumes)
+	}
+
+	// Once the members are rolled out the valid user is active.
+	dep.Status = appsv1.DeploymentStatus{ObservedGeneration: dep.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+	if err := cl.Status().Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment status: (%v)", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !reflect.DeepEqual(updated.Status.ActiveUsers, []string{"alice"}) {
+		t.Errorf("active users %v are not the expected users [alice]", updated.Status.ActiveUsers)
+	}
+	statuses := map[string]cachev1alpha1.MemcachedUserStatus{
+		"alice":    {Active: true},
+		"bob":      {Message: "Password Secret bob-password not found"},
+		"operator": {Message: "Username memcached-operator is reserved for the operator"},
+		"carol":    {},
+	}
+	for name, status := range statuses {
+		u := &cachev1alpha1.MemcachedUser{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, u); err != nil {
+			t.Fatalf("get user %s: (%v)", name, err)
+		}
+		if u.Status != status {
+			t.Errorf("user %s status %v is not the expected status %v", name, u.Status, status)
+		}
+	}
+
+	// Changing a password updates the database, keeping the operator password,
+	// and rolls the members.
+	password.Data["password"] = []byte("changed")
+	if err := cl.Update(context.TODO(), password); err != nil {
+		t.Fatalf("update password: (%v)", err)
+	}
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter != secretResyncPeriod {
+		t.Errorf("reconcile requeued after %s instead of the password resync period", res.RequeueAfter)
+	}
+	secret = &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, secret); err != nil {
+		t.Fatalf("get SASL secret: (%v)", err)
+	}
+	expected = "memcached-operator:" + operatorPassword + "\nalice:changed\n"
+	if database := string(secret.Data[saslDatabaseKey]); database != expected {
+		t.Errorf("SASL database %q is not the expected database %q", database, expected)
+	}
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	expectedHash = configHash(&dep.Spec.Template.Spec, map[string]string{"sasl": saslHash(secret.Data)})
+	if hash := dep.Spec.Template.Annotations[configHashAnnotation]; hash != expectedHash {
+		t.Errorf("pod template config hash (%s) was not updated to the SASL secret (%s)", hash, expectedHash)
+	}
+
+	// Disabling SASL removes the database and unmounts it.
+	updated.Spec.Auth = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(memcached.Name), Namespace: memcached.Namespace}, &corev1.Secret{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("SASL secret not deleted with SASL disabled: (%v)", err)
+	}
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 0 {
+		t.Errorf("pod template volumes %v still mount the SASL secret", volumes)
+	}
+}
+
+// TestMemcachedTLS checks that the operator issues and renews the certificates
+// of the members, and that a Secret of the user or disabling TLS replaces them.
+func TestMemcachedTLS(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:    1,
+			Version: "1.6.9",
+			TLS:     &cachev1alpha1.TLS{Enabled: true},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(100)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	getSecret := func(name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, secret); err != nil {
+			t.Fatalf("get secret %s: (%v)", name, err)
+		}
+		return secret
+	}
+	getDeployment := func() *appsv1.Deployment {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		return dep
+	}
+	// verify checks the issued certificate is valid for the Service against the published CA bundle.
+	verify := func(secret *corev1.Secret) *x509.Certificate {
+		bundle := &corev1.ConfigMap{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, bundle); err != nil {
+			t.Fatalf("get CA bundle: (%v)", err)
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM([]byte(bundle.Data[caBundleKey]))
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			t.Fatalf("parse certificate: (%v)", err)
+		}
+		for _, name := range []string{"memcached-operator.memcached.svc", "memcached-operator-0.memcached-operator-headless.memcached.svc.cluster.local"} {
+			if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+				t.Errorf("certificate is not valid for %s: (%v)", name, err)
+			}
+		}
+		return cert
+	}
+
+	// The operator issues a CA and a certificate, and mounts it into the members.
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	secret := getSecret(tlsSecretName(memcached.Name))
+	cert := verify(secret)
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity != cachev1alpha1.DefaultCertificateDuration+certificateBackdate {
+		t.Errorf("certificate validity (%s) is not the default duration", validity)
+	}
+	dep := getDeployment()
+	container := dep.Spec.Template.Spec.Containers[0]
+	expected := []string{"-Z", "-o", "ssl_chain_cert=/etc/memcached/tls/tls.crt,ssl_key=/etc/memcached/tls/tls.key"}
+	if command := container.Command; !reflect.DeepEqual(command[len(command)-3:], expected) {
+		t.Errorf("memcached command %v does not enable TLS", command)
+	}
+	hash := configHash(&dep.Spec.Template.Spec, map[string]string{"tls": dataHash(secret.Data, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)})
+	if dep.Spec.Template.Annotations[configHashAnnotation] != hash {
+		t.Errorf("pod template config hash (%s) does not match the TLS secret (%s)", dep.Spec.Template.Annotations[configHashAnnotation], hash)
+	}
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != secret.Name {
+		t.Errorf("pod template volumes %v do not mount the TLS secret", volumes)
+	}
+
+	// A certificate due for renewal is renewed, rolling the members.
+	ca, err := parseKeyPair(getSecret(caSecretName(memcached.Name)).Data[corev1.TLSCertKey], getSecret(caSecretName(memcached.Name)).Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatalf("parse CA: (%v)", err)
+	}
+	old, err := issueKeyPair(&x509.Certificate{
+		DNSNames:  dnsNamesForMemcached(memcached),
+		NotBefore: time.Now().Add(-2 * time.Hour),
+		NotAfter:  time.Now().Add(30 * time.Minute),
+	}, ca)
+	if err != nil {
+		t.Fatalf("issue certificate: (%v)", err)
+	}
+	secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey] = old.certPEM, old.keyPEM
+	if err := cl.Update(context.TODO(), secret); err != nil {
+		t.Fatalf("update TLS secret: (%v)", err)
+	}
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter != secretResyncPeriod {
+		t.Errorf("reconcile requeued after %s instead of the secret resync period", res.RequeueAfter)
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if cert := verify(secret); cert.SerialNumber.Cmp(old.cert.SerialNumber) == 0 {
+		t.Error("certificate due for renewal was not renewed")
+	}
+	if dep := getDeployment(); dep.Spec.Template.Annotations[configHashAnnotation] == hash {
+		t.Error("pod template config hash was not updated to the renewed certificate")
+	}
+
+	// A CA due for renewal is replaced, keeping the previous CA in the bundle until it expires.
+	oldCA, err := issueKeyPair(&x509.Certificate{
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(30 * time.Minute),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("issue CA: (%v)", err)
+	}
+	caSecret := getSecret(caSecretName(memcached.Name))
+	caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey] = oldCA.certPEM, oldCA.keyPEM
+	if err := cl.Update(context.TODO(), caSecret); err != nil {
+		t.Fatalf("update CA secret: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if cert := verify(secret); cert.CheckSignatureFrom(oldCA.cert) == nil {
+		t.Error("certificate was not reissued by the renewed CA")
+	}
+	if bundle := string(secret.Data[caBundleKey]); !strings.HasSuffix(bundle, string(oldCA.certPEM)) {
+		t.Error("CA bundle does not keep the previous CA")
+	}
+
+	// Switching to a Secret of the user removes the issued certificates and mounts that Secret.
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.TLS.SecretName = "memcached-cert"
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err == nil || !strings.Contains(err.Error(), "TLS Secret memcached-cert not found") {
+		t.Errorf("reconcile did not fail on the missing TLS secret: (%v)", err)
+	}
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-cert", Namespace: "memcached"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: old.certPEM, corev1.TLSPrivateKeyKey: old.keyPEM},
+	}
+	if err := cl.Create(context.TODO(), userSecret); err != nil {
+		t.Fatalf("create TLS secret: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	for _, name := range []string{tlsSecretName(memcached.Name), caSecretName(memcached.Name)} {
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, &corev1.Secret{}); !errors.IsNotFound(err) {
+			t.Errorf("issued secret %s not deleted: (%v)", name, err)
+		}
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("CA bundle not deleted: (%v)", err)
+	}
+	dep = getDeployment()
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 1 || volumes[0].Secret.SecretName != userSecret.Name {
+		t.Errorf("pod template volumes %v do not mount the TLS secret of the user", volumes)
+	}
+
+	// Disabling TLS unmounts the certificate.
+	updated = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.TLS = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	dep = getDeployment()
+	if volumes := dep.Spec.Template.Spec.Volumes; len(volumes) != 0 {
+		t.Errorf("pod template volumes %v still mount the TLS secret", volumes)
+	}
+	if command := dep.Spec.Template.Spec.Containers[0].Command; reflect.DeepEqual(command[len(command)-3:], expected) {
+		t.Errorf("memcached command %v still enables TLS", command)
+	}
+}
+
+// TestMemcachedCARotation checks that a renewed CA is published in the CA
+// bundle before the certificate of the members is reissued by it.
+func TestMemcachedCARotation(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:    1,
+			Version: "1.6.9",
+			TLS:     &cachev1alpha1.TLS{Enabled: true},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(100)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	getSecret := func(name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: memcached.Namespace}, secret); err != nil {
+			t.Fatalf("get secret %s: (%v)", name, err)
+		}
+		return secret
+	}
+	getBundle := func() string {
+		bundle := &corev1.ConfigMap{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(memcached.Name), Namespace: memcached.Namespace}, bundle); err != nil {
+			t.Fatalf("get CA bundle: (%v)", err)
+		}
+		return bundle.Data[caBundleKey]
+	}
+	// served reports whether the members are rolled to the certificate of the given TLS secret.
+	served := func(secret *corev1.Secret) bool {
+		dep := &appsv1.Deployment{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+			t.Fatalf("get deployment: (%v)", err)
+		}
+		hash := configHash(&dep.Spec.Template.Spec, map[string]string{"tls": dataHash(secret.Data, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)})
+		return dep.Spec.Template.Annotations[configHashAnnotation] == hash
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	// Serve a certificate issued by a CA due for renewal.
+	oldCA, err := issueKeyPair(&x509.Certificate{
+		NotBefore:             time.Now().Add(-3 * time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("issue CA: (%v)", err)
+	}
+	old, err := issueKeyPair(&x509.Certificate{
+		DNSNames:  dnsNamesForMemcached(memcached),
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	}, oldCA)
+	if err != nil {
+		t.Fatalf("issue certificate: (%v)", err)
+	}
+	caSecret := getSecret(caSecretName(memcached.Name))
+	caSecret.Data = map[string][]byte{corev1.TLSCertKey: oldCA.certPEM, corev1.TLSPrivateKeyKey: oldCA.keyPEM}
+	if err := cl.Update(context.TODO(), caSecret); err != nil {
+		t.Fatalf("update CA secret: (%v)", err)
+	}
+	secret := getSecret(tlsSecretName(memcached.Name))
+	secret.Data = map[string][]byte{corev1.TLSCertKey: old.certPEM, corev1.TLSPrivateKeyKey: old.keyPEM, caBundleKey: oldCA.certPEM}
+	if err := cl.Update(context.TODO(), secret); err != nil {
+		t.Fatalf("update TLS secret: (%v)", err)
+	}
+
+	// The renewed CA is published next to the previous one, the certificate is kept.
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	ca, err := parseCertificate(getSecret(caSecretName(memcached.Name)).Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatalf("parse CA: (%v)", err)
+	}
+	if ca.Equal(oldCA.cert) {
+		t.Fatal("CA due for renewal was not renewed")
+	}
+	bundle := getBundle()
+	if !strings.HasSuffix(bundle, string(oldCA.certPEM)) || len(bundle) == len(oldCA.certPEM) {
+		t.Errorf("CA bundle does not hold both the renewed and the previous CA")
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	if !reflect.DeepEqual(secret.Data[corev1.TLSCertKey], old.certPEM) {
+		t.Error("certificate was reissued before the CA bundle was distributed")
+	}
+	if string(secret.Data[caBundleKey]) != bundle {
+		t.Error("TLS secret does not hold the CA bundle")
+	}
+	if !served(secret) {
+		t.Error("members do not serve the certificate issued by the previous CA")
+	}
+
+	// Once the CA bundle is distributed, the certificate is reissued by the renewed CA.
+	defer func(period time.Duration) { caBundlePropagationPeriod = period }(caBundlePropagationPeriod)
+	caBundlePropagationPeriod = 0
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	secret = getSecret(tlsSecretName(memcached.Name))
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatalf("parse certificate: (%v)", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate was not reissued by the renewed CA: (%v)", err)
+	}
+	if !served(secret) {
+		t.Error("members were not rolled to the reissued certificate")
+	}
+}
+
+// TestDisruptionBudgetForMemcached checks the default budget and that bounds
+// forbidding every eviction are relaxed so node drains can make progress.
+func TestDisruptionBudgetForMemcached(t *testing.T) {
+	intOrString := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+	tests := []struct {
+		name           string
+		size           int32
+		budget         *cachev1alpha1.DisruptionBudget
+		minAvailable   *intstr.IntOrString
+		maxUnavailable *intstr.IntOrString
+	}{
+		{"default", 3, nil, nil, intOrString(intstr.FromInt(1))},
+		{"min available", 5, &cachev1alpha1.DisruptionBudget{MinAvailable: intOrString(intstr.FromInt(3))}, intOrString(intstr.FromInt(3)), nil},
+		{"min available every member", 3, &cachev1alpha1.DisruptionBudget{MinAvailable: intOrString(intstr.FromString("100%"))}, intOrString(intstr.FromInt(2)), nil},
+		{"max unavailable percentage", 5, &cachev1alpha1.DisruptionBudget{MaxUnavailable: intOrString(intstr.FromString("40%"))}, nil, intOrString(intstr.FromString("40%"))},
+		{"max unavailable none", 3, &cachev1alpha1.DisruptionBudget{MaxUnavailable: intOrString(intstr.FromInt(0))}, nil, intOrString(intstr.FromInt(1))},
+	}
+	for _, tt := range tests {
+		m := &cachev1alpha1.Memcached{Spec: cachev1alpha1.MemcachedSpec{Size: tt.size, DisruptionBudget: tt.budget}}
+		minAvailable, maxUnavailable := disruptionBudgetForMemcached(m)
+		if !reflect.DeepEqual(minAvailable, tt.minAvailable) || !reflect.DeepEqual(maxUnavailable, tt.maxUnavailable) {
+			t.Errorf("%s: budget (%v, %v) is not the expected (%v, %v)", tt.name, minAvailable, maxUnavailable, tt.minAvailable, tt.maxUnavailable)
+		}
+	}
+}
+
+// TestMemcachedPodDisruptionBudget checks that a PodDisruptionBudget is
+// created for a cluster and removed once it shrinks to a single member.
+func TestMemcachedPodDisruptionBudget(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, pdb); err != nil {
+		t.Fatalf("get poddisruptionbudget: (%v)", err)
+	}
+	if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("poddisruptionbudget max unavailable (%v) is not the expected 1", pdb.Spec.MaxUnavailable)
+	}
+
+	// Shrink the cluster to a single member.
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	memcached.Spec.Size = 1
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, &policyv1beta1.PodDisruptionBudget{}); err == nil {
+		t.Error("poddisruptionbudget kept for a single member")
+	}
+}
+
+// TestMemcachedNetworkPolicy checks that restricting access admits only the
+// selected clients and the operator, and that lifting it removes the policy.
+func TestMemcachedNetworkPolicy(t *testing.T) {
+	clients := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:   3,
+			Access: &cachev1alpha1.Access{PodSelector: clients},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	getPeers := func() []networkingv1.NetworkPolicyPeer {
+		policy := &networkingv1.NetworkPolicy{}
+		if err := cl.Get(context.TODO(), req.NamespacedName, policy); err != nil {
+			t.Fatalf("get networkpolicy: (%v)", err)
+		}
+		if !reflect.DeepEqual(policy.Spec.PodSelector.MatchLabels, labelsForMemcached(memcached.Name)) {
+			t.Errorf("networkpolicy selects %v instead of the memcached pods", policy.Spec.PodSelector.MatchLabels)
+		}
+		if len(policy.Spec.Ingress) != 1 || len(policy.Spec.Ingress[0].Ports) != 1 || policy.Spec.Ingress[0].Ports[0].Port.IntValue() != 11211 {
+			t.Fatalf("networkpolicy ingress %v does not only admit the memcached port", policy.Spec.Ingress)
+		}
+		return policy.Spec.Ingress[0].From
+	}
+
+	// Only the selected clients are admitted.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	expected := []networkingv1.NetworkPolicyPeer{{PodSelector: clients}}
+	if peers := getPeers(); !reflect.DeepEqual(peers, expected) {
+		t.Errorf("networkpolicy peers %v are not the expected peers %v", peers, expected)
+	}
+
+	// The operator is admitted while it probes the members.
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.Probe = &cachev1alpha1.Probe{}
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	expected = append(expected, networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: operatorPodLabels}})
+	if peers := getPeers(); !reflect.DeepEqual(peers, expected) {
+		t.Errorf("networkpolicy peers %v are not the expected peers %v", peers, expected)
+	}
+
+	// Lifting the restriction removes the NetworkPolicy.
+	updated = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.Access = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, &networkingv1.NetworkPolicy{}); !errors.IsNotFound(err) {
+		t.Errorf("networkpolicy kept without access restriction: (%v)", err)
+	}
+}
+
+// TestMemcachedPlacement checks that the placement is reflected in the pod
+// template, removed from it with the placement, and that the members are
+// counted per zone.
+func TestMemcachedPlacement(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size: 3,
+			Placement: &cachev1alpha1.Placement{
+				AntiAffinity:      cachev1alpha1.AntiAffinityHard,
+				ZoneSpread:        &cachev1alpha1.TopologySpread{WhenUnsatisfiable: corev1.DoNotSchedule},
+				NodeSelector:      map[string]string{"pool": "cache"},
+				Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "cache"}},
+				PriorityClassName: "cache",
+			},
+		},
+	}
+	objs := []runtime.Object{memcached}
+	for i, zone := range []string{"zone-a", "zone-b", "zone-a"} {
+		node := "node-" + strconv.Itoa(i)
+		objs = append(objs,
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: node, Labels: map[string]string{corev1.LabelZoneFailureDomainStable: zone}}},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: memcached.Name + "-" + strconv.Itoa(i), Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+				Spec:       corev1.PodSpec{NodeName: node},
+			})
+	}
+	objs = append(objs, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: memcached.Name + "-pending", Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+	})
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(objs...)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(20)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	spec := dep.Spec.Template.Spec
+	if spec.Affinity == nil || spec.Affinity.PodAntiAffinity == nil || len(spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("pod affinity %v does not require members on distinct nodes", spec.Affinity)
+	}
+	expectedSpread := []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelZoneFailureDomainStable,
+		WhenUnsatisfiable: corev1.DoNotSchedule,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: labelsForMemcached(memcached.Name)},
+	}}
+	if !reflect.DeepEqual(spec.TopologySpreadConstraints, expectedSpread) {
+		t.Errorf("topology spread constraints %v are not the expected constraints %v", spec.TopologySpreadConstraints, expectedSpread)
+	}
+	if spec.NodeSelector["pool"] != "cache" || len(spec.Tolerations) != 1 || spec.PriorityClassName != "cache" {
+		t.Errorf("pod spec does not select the cache nodes: nodeSelector %v, tolerations %v, priorityClassName %q",
+			spec.NodeSelector, spec.Tolerations, spec.PriorityClassName)
+	}
+
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	expectedZones := []cachev1alpha1.ZoneStatus{{Zone: "zone-a", Members: 2}, {Zone: "zone-b", Members: 1}}
+	if !reflect.DeepEqual(updated.Status.Zones, expectedZones) {
+		t.Errorf("zones %v are not the expected zones %v", updated.Status.Zones, expectedZones)
+	}
+
+	// Removing the placement lets the members be scheduled anywhere again.
+	updated.Spec.Placement = nil
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	dep = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	spec = dep.Spec.Template.Spec
+	if spec.Affinity != nil || spec.TopologySpreadConstraints != nil || spec.NodeSelector != nil || spec.Tolerations != nil || spec.PriorityClassName != "" {
+		t.Errorf("pod spec kept the removed placement: %+v", spec)
+	}
+}
+
+// TestMemcachedAutoscaling checks that enabling autoscaling creates a
+// HorizontalPodAutoscaler scaling the Memcached through its scale subresource.
+func TestMemcachedAutoscaling(t *testing.T) {
+	minReplicas := int32(3)
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec: cachev1alpha1.MemcachedSpec{
+			Size:        3,
+			Autoscaling: &cachev1alpha1.Autoscaling{MinReplicas: &minReplicas, MaxReplicas: 8},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, hpa); err != nil {
+		t.Fatalf("get horizontalpodautoscaler: (%v)", err)
+	}
+	if ref := hpa.Spec.ScaleTargetRef; ref.Kind != "Memcached" || ref.Name != memcached.Name {
+		t.Errorf("horizontalpodautoscaler targets %v instead of the Memcached", ref)
+	}
+	if *hpa.Spec.MinReplicas != 3 || hpa.Spec.MaxReplicas != 8 {
+		t.Errorf("horizontalpodautoscaler bounds (%d, %d) are not the expected (3, 8)", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != cachev1alpha1.DefaultTargetCPUUtilizationPercentage {
+		t.Errorf("horizontalpodautoscaler metrics %v do not target the default CPU utilization", hpa.Spec.Metrics)
+	}
+
+	// The status publishes the pod selector for the scale subresource.
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if memcached.Status.Selector != "app=memcached,memcached_cr=memcached-operator" {
+		t.Errorf("status selector %q does not select the memcached pods", memcached.Status.Selector)
+	}
+}
+
+// TestProbeMembers checks that probe results are carried over until the
+// members are due again, and that unreachable members degrade the cluster.
+func TestProbeMembers(t *testing.T) {
+	reachable, unreachable := true, false
+	lastProbe := metav1.NewTime(time.Now().Add(-10 * time.Second))
+	memcached := &cachev1alpha1.Memcached{
+		Spec: cachev1alpha1.MemcachedSpec{Size: 3, Probe: &cachev1alpha1.Probe{PeriodSeconds: 60}},
+		Status: cachev1alpha1.MemcachedStatus{
+			Members: []cachev1alpha1.MemberStatus{
+				{Name: "a", PodIP: "10.0.0.1", Reachable: &reachable, Version: "1.5.20", UptimeSeconds: 30, LastProbeTime: &lastProbe},
+				{Name: "b", PodIP: "10.0.0.2", Reachable: &unreachable, LastProbeTime: &lastProbe},
+			},
+		},
+	}
+	members := []cachev1alpha1.MemberStatus{
+		{Name: "a", PodIP: "10.0.0.1", Ready: true},
+		{Name: "b", PodIP: "10.0.0.2", Ready: true},
+		{Name: "c", Ready: false},
+	}
+
+	next := probeMembers(logf.Log, memcached, members, nil)
+	if next <= 0 || next > 50*time.Second {
+		t.Errorf("next probe in %s is not when the members are due", next)
+	}
+	if members[0].Version != "1.5.20" || members[0].UptimeSeconds != 30 || !*members[0].Reachable {
+		t.Errorf("member %v did not carry over its last probe", members[0])
+	}
+	if members[2].LastProbeTime != nil {
+		t.Errorf("member %v without an IP was probed", members[2])
+	}
+
+	status := &cachev1alpha1.MemcachedStatus{Members: members}
+	setConditions(status, &workloadStatus{kind: "Deployment", replicas: 3}, 1)
+	setMembersDegraded(status, 1)
+	degraded := status.FindCondition(cachev1alpha1.ConditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != "MembersUnreachable" {
+		t.Errorf("degraded condition %v does not report the unreachable member", degraded)
+	}
+
+	// Disabling probing stops requeueing for probes.
+	memcached.Spec.Probe = nil
+	if next := probeMembers(logf.Log, memcached, members, nil); next != 0 {
+		t.Errorf("next probe in %s while probing is disabled", next)
+	}
+}
+
+// serveFakeMemcached starts an in-process memcached server answering the
+// stats command with the given statistics.
+func serveFakeMemcached(t *testing.T, stats string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					response := "ERROR\r\n"
+					switch strings.TrimSpace(line) {
+					case "stats":
+						response = stats
+					case "flush_all":
+						response = "OK\r\n"
+					}
+					if _, err := conn.Write([]byte(response)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+// TestMemcachedConnectionInfo checks that the connection info follows the
+// ready members, and moves to a Secret when SASL is enabled.
+func TestMemcachedConnectionInfo(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached", Finalizers: []string{memcachedFinalizer}},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	pod := func(name, ip string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: memcached.Namespace, Labels: labelsForMemcached(memcached.Name)},
+			Status: corev1.PodStatus{
+				PodIP:      ip,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached, pod("b", "10.0.0.2", true), pod("a", "10.0.0.1", true), pod("c", "10.0.0.3", false))
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(100)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+	key := types.NamespacedName{Name: connectionInfoName(memcached.Name), Namespace: memcached.Namespace}
+	reconcileTwice := func() {
+		for i := 0; i < 2; i++ {
+			if _, err := r.Reconcile(req); err != nil {
+				t.Fatalf("reconcile: (%v)", err)
+			}
+		}
+	}
+	reconcileTwice()
+
+	// The ready members are published ordered by name, next to the Service.
+	configMap := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), key, configMap); err != nil {
+		t.Fatalf("get connection info: (%v)", err)
+	}
+	expected := map[string]string{
+		connectionAddressKey:  "memcached-operator.memcached.svc:11211",
+		connectionMembersKey:  "10.0.0.1:11211,10.0.0.2:11211",
+		connectionProtocolKey: "ascii",
+		connectionTLSKey:      "false",
+	}
+	if !reflect.DeepEqual(configMap.Data, expected) {
+		t.Errorf("connection info %v is not the expected %v", configMap.Data, expected)
+	}
+	for label, value := range connectionInfoLabels(memcached) {
+		if configMap.Labels[label] != value {
+			t.Errorf("connection info label %s (%s) is not %s", label, configMap.Labels[label], value)
+		}
+	}
+	updated := &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	ref := cachev1alpha1.ConnectionInfoReference{Kind: "ConfigMap", Name: key.Name}
+	if updated.Status.ConnectionInfo == nil || *updated.Status.ConnectionInfo != ref {
+		t.Errorf("status connection info %v is not %v", updated.Status.ConnectionInfo, ref)
+	}
+
+	// A member becoming ready is published.
+	if err := cl.Update(context.TODO(), pod("c", "10.0.0.3", true)); err != nil {
+		t.Fatalf("update pod: (%v)", err)
+	}
+	reconcileTwice()
+	if err := cl.Get(context.TODO(), key, configMap); err != nil {
+		t.Fatalf("get connection info: (%v)", err)
+	}
+	if members := configMap.Data[connectionMembersKey]; members != "10.0.0.1:11211,10.0.0.2:11211,10.0.0.3:11211" {
+		t.Errorf("connection info members (%s) do not include the ready member", members)
+	}
+
+	// Enabling SASL moves the connection info to a Secret.
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	updated.Spec.Auth = &cachev1alpha1.Auth{SASL: &cachev1alpha1.SASLAuth{Enabled: true}}
+	if err := cl.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	reconcileTwice()
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), key, secret); err != nil {
+		t.Fatalf("get connection info secret: (%v)", err)
+	}
+	if protocol := string(secret.Data[connectionProtocolKey]); protocol != "binary" {
+		t.Errorf("connection info protocol (%s) is not binary with SASL", protocol)
+	}
+	if err := cl.Get(context.TODO(), key, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("connection info ConfigMap was not deleted: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	ref.Kind = "Secret"
+	if updated.Status.ConnectionInfo == nil || *updated.Status.ConnectionInfo != ref {
+		t.Errorf("status connection info %v is not %v", updated.Status.ConnectionInfo, ref)
+	}
+}
+
+// TestMemcachedTeardown checks that a failed flush is retried until the
+// teardown times out, and that the connection info is removed on release.
+func TestMemcachedTeardown(t *testing.T) {
+	deleted := metav1.NewTime(time.Now())
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "memcached-operator",
+			Namespace:         "memcached",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{memcachedFinalizer},
+		},
+		Spec: cachev1alpha1.MemcachedSpec{Size: 3, DeletionPolicy: cachev1alpha1.DeletionPolicyFlush, TeardownTimeoutSeconds: 60},
+	}
+	connectionInfo := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name: "memcached-operator-connection", Namespace: "memcached", Labels: connectionInfoLabels(memcached),
+	}}
+	unrelated := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "memcached"}}
+	// The member cannot be flushed as nothing serves memcached on its address.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator-0", Namespace: "memcached", Labels: labelsForMemcached(memcached.Name)},
+		Status:     corev1.PodStatus{PodIP: "127.0.0.1"},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached, connectionInfo, unrelated, pod)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileMemcached{client: cl, scheme: s, recorder: recorder, apiReader: cl}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}}
+
+	// A failed flush is retried while the teardown timeout has not passed.
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter <= 0 || res.RequeueAfter > teardownRetryPeriod {
+		t.Errorf("failed teardown is retried after %s instead of at most %s", res.RequeueAfter, teardownRetryPeriod)
+	}
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if !hasFinalizer(memcached) {
+		t.Error("memcached was released before its members were flushed")
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning TeardownFailed") {
+		t.Errorf("event %q does not report the failed teardown", event)
+	}
+
+	// Once the timeout passed, the CR is released with the remaining steps skipped.
+	memcached.DeletionTimestamp = &metav1.Time{Time: deleted.Add(-time.Hour)}
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if hasFinalizer(memcached) {
+		t.Error("memcached was not released after the teardown timed out")
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning TeardownTimedOut") {
+		t.Errorf("event %q does not report the teardown timeout", event)
+	}
+
+	// Without flushing, the connection info is removed before the CR is released.
+	memcached.Finalizers = []string{memcachedFinalizer}
+	memcached.Spec.DeletionPolicy = cachev1alpha1.DeletionPolicyDelete
+	if err := cl.Update(context.TODO(), memcached); err != nil {
+		t.Fatalf("update memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	memcached = &cachev1alpha1.Memcached{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, memcached); err != nil {
+		t.Fatalf("get memcached: (%v)", err)
+	}
+	if hasFinalizer(memcached) {
+		t.Error("memcached was not released after its teardown")
+	}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: connectionInfo.Name, Namespace: connectionInfo.Namespace}, &corev1.ConfigMap{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("connection info was not deleted: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: unrelated.Name, Namespace: unrelated.Namespace}, &corev1.ConfigMap{}); err != nil {
+		t.Errorf("get unrelated configmap: (%v)", err)
+	}
+}
+
+// TestFlushMembers checks that every member is flushed, and that an
+// unreachable member fails the flush.
+func TestFlushMembers(t *testing.T) {
+	listener := serveFakeMemcached(t, "END\r\n")
+	defer listener.Close()
+	if err := flushMembers([]string{listener.Addr().String()}, time.Second, nil); err != nil {
+		t.Errorf("flush members: (%v)", err)
+	}
+
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: (%v)", err)
+	}
+	down.Close()
+	if err := flushMembers([]string{listener.Addr().String(), down.Addr().String()}, time.Second, nil); err == nil {
+		t.Error("flushing an unreachable member did not fail")
+	}
+}
+
+// TestStatsCollector checks that the stats of the members listed in the
+// Memcached status are exported, and unreachable members reported down.
+func TestStatsCollector(t *testing.T) {
+	listener := serveFakeMemcached(t, "STAT get_hits 10\r\nSTAT get_misses 2\r\nSTAT evictions 1\r\n"+
+		"STAT bytes 2048\r\nSTAT curr_items 5\r\nSTAT curr_connections 3\r\nSTAT uptime 60\r\nEND\r\n")
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "memcached-operator", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+		Status: cachev1alpha1.MemcachedStatus{
+			Members: []cachev1alpha1.MemberStatus{
+				{Name: "up", PodIP: "127.0.0.1"},
+				{Name: "down", PodIP: "127.0.0.2"},
+				{Name: "pending"},
+			},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedList{})
+	c := NewStatsCollector(fake.NewFakeClient(memcached), nil, logf.Log)
+	c.port = port
+
+	// Nothing answers on the second member, so it is reported down.
+
+	expected := `
+# HELP memcached_current_items Number of items stored in the cache.
+# TYPE memcached_current_items gauge
+memcached_current_items{memcached="memcached-operator",namespace="memcached",pod="up"} 5
+# HELP memcached_hits_total Number of get requests that found the key.
+# TYPE memcached_hits_total counter
+memcached_hits_total{memcached="memcached-operator",namespace="memcached",pod="up"} 10
+# HELP memcached_up Whether the memcached member answered the stats command.
+# TYPE memcached_up gauge
+memcached_up{memcached="memcached-operator",namespace="memcached",pod="down"} 0
+memcached_up{memcached="memcached-operator",namespace="memcached",pod="up"} 1
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected), "memcached_up", "memcached_hits_total", "memcached_current_items")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// slowReader is a client.Reader whose reads take a while, recording the most
+// reads running at once.
+type slowReader struct {
+	client.Reader
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func (r *slowReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+	r.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return r.Reader.Get(ctx, key, obj)
+}
+
+// TestStatsCollectorCredentials checks that the member credentials of the
+// Memcacheds are read concurrently, but at most statsConcurrency at once.
+func TestStatsCollectorCredentials(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, &cachev1alpha1.Memcached{}, &cachev1alpha1.MemcachedList{})
+	var objs []runtime.Object
+	for i := 0; i < 2*statsConcurrency; i++ {
+		name := "memcached-" + strconv.Itoa(i)
+		objs = append(objs,
+			&cachev1alpha1.Memcached{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "memcached"},
+				Spec: cachev1alpha1.MemcachedSpec{
+					Size: 1,
+					Auth: &cachev1alpha1.Auth{SASL: &cachev1alpha1.SASLAuth{Enabled: true}},
+				},
+				Status: cachev1alpha1.MemcachedStatus{
+					Members: []cachev1alpha1.MemberStatus{{Name: name + "-0", PodIP: "127.0.0.2"}},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: saslSecretName(name), Namespace: "memcached"},
+				Data:       map[string][]byte{saslOperatorPasswordKey: []byte("s3cret")},
+			},
+		)
+	}
+	cl := fake.NewFakeClient(objs...)
+	secrets := &slowReader{Reader: cl}
+	c := NewStatsCollector(cl, secrets, logf.Log)
+	c.port = 1
+
+	// Nothing answers on the members, so each is reported down.
+	if n := testutil.CollectAndCount(c); n != 2*statsConcurrency {
+		t.Errorf("collected %d metrics, expected one per member (%d)", n, 2*statsConcurrency)
+	}
+	if secrets.maxRunning < 2 || secrets.maxRunning > statsConcurrency {
+		t.Errorf("%d credential reads ran at once, expected between 2 and %d", secrets.maxRunning, statsConcurrency)
+	}
+}
+
+// conflictingStatusClient is a client whose status updates always conflict.
+type conflictingStatusClient struct {
+	client.Client
+}
+
+func (c conflictingStatusClient) Status() client.StatusWriter {
+	return conflictingStatusWriter{}
+}
+
+type conflictingStatusWriter struct{}
+
+func (conflictingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return errors.NewConflict(cachev1alpha1.SchemeGroupVersion.WithResource("memcacheds").GroupResource(), "", nil)
+}
+
+func (conflictingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.NewConflict(cachev1alpha1.SchemeGroupVersion.WithResource("memcacheds").GroupResource(), "", nil)
+}
+
+// metricValue scrapes the controller-runtime metrics registry and returns the value of
+// the series with the given name and labels, or the sample count of a histogram.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: (%v)", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if v, ok := labels[label.GetName()]; ok && v != label.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				return m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+// TestReconcileMetrics checks the operational metrics recorded by Reconcile
+// by scraping the metrics registry.
+func TestReconcileMetrics(t *testing.T) {
+	memcached := &cachev1alpha1.Memcached{
+		ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "memcached"},
+		Spec:       cachev1alpha1.MemcachedSpec{Size: 3},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(cachev1alpha1.SchemeGroupVersion, memcached, &cachev1alpha1.MemcachedUser{}, &cachev1alpha1.MemcachedUserList{})
+	cl := fake.NewFakeClient(memcached)
+	r := &ReconcileMemcached{client: cl, apiReader: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace},
+	}
+
+	deploymentsCreated := metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Deployment", "operation": "create"})
+	servicesCreated := metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Service", "operation": "create"})
+	deploymentsUpdated := metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Deployment", "operation": "update"})
+	scaledUp := metricValue(t, "memcached_operator_scale_operations_total", map[string]string{"direction": "up"})
+	conflicts := metricValue(t, "memcached_operator_status_update_conflicts_total", nil)
+	workloadPhases := metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "workload"})
+
+	// Create the Deployment, then the Service and the status.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	// Scale the Deployment down behind the operator's back.
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, dep); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	one := int32(1)
+	dep.Spec.Replicas = &one
+	if err := cl.Update(context.TODO(), dep); err != nil {
+		t.Fatalf("update deployment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	checks := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"deployments created", metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Deployment", "operation": "create"}), deploymentsCreated + 1},
+		{"services created", metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Service", "operation": "create"}), servicesCreated + 1},
+		{"deployments updated", metricValue(t, "memcached_operator_object_operations_total", map[string]string{"kind": "Deployment", "operation": "update"}), deploymentsUpdated + 1},
+		{"scale ups", metricValue(t, "memcached_operator_scale_operations_total", map[string]string{"direction": "up"}), scaledUp + 1},
+		{"workload phases", metricValue(t, "memcached_operator_reconcile_phase_duration_seconds", map[string]string{"phase": "workload"}), workloadPhases + 3},
+		{"desired replicas", metricValue(t, "memcached_operator_replicas", map[string]string{"namespace": "memcached", "memcached": "metrics", "type": "desired"}), 3},
+	}
+	for _, c := range checks {
+		if c.value != c.expected {
+			t.Errorf("%s metric (%v) is not the expected value (%v)", c.name, c.value, c.expected)
+		}
+	}
+
+	// A conflicting status update is counted and requeued.
+	r.client = conflictingStatusClient{cl}
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if !res.Requeue {
+		t.Error("reconcile did not requeue after a status update conflict")
+	}
+	if v := metricValue(t, "memcached_operator_status_update_conflicts_total", nil); v != conflicts+1 {
+		t.Errorf("status update conflicts metric (%v) is not the expected value (%v)", v, conflicts+1)
+	}
+
+	// The replica series are removed with the Memcached.
+	r.client = cl
+	if err := cl.Delete(context.TODO(), memcached); err != nil {
+		t.Fatalf("delete memcached: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if v := metricValue(t, "memcached_operator_replicas", map[string]string{"memcached": "metrics"}); v != 0 {
+		t.Errorf("replica series of a deleted Memcached still reported (%v)", v)
+	}
 }
@@ -0,0 +1,67 @@
+package memcached
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/memcache"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// memberDialer connects the operator to the members of a memcached CR
+type memberDialer struct {
+	// credentials are the SASL credentials to authenticate with, nil when SASL is disabled
+	credentials *memberCredentials
+	// tlsConfig is the TLS configuration of the connections, nil when TLS is disabled
+	tlsConfig *tls.Config
+}
+
+// dialerForMemcached returns the dialer connecting to the members of the given memcached CR, with
+// the SASL credentials and the CA bundle read from their Secrets with the given reader.
+func dialerForMemcached(ctx context.Context, reader client.Reader, m *cachev1alpha1.Memcached) (*memberDialer, error) {
+	dialer := &memberDialer{}
+	if m.Spec.SASLEnabled() {
+		secret := &corev1.Secret{}
+		if err := reader.Get(ctx, types.NamespacedName{Name: saslSecretName(m.Name), Namespace: m.Namespace}, secret); err != nil {
+			return nil, err
+		}
+		dialer.credentials = &memberCredentials{username: operatorUsername, password: string(secret.Data[saslOperatorPasswordKey])}
+	}
+	if m.Spec.TLSEnabled() {
+		secret := &corev1.Secret{}
+		if err := reader.Get(ctx, types.NamespacedName{Name: certificateSecretName(m), Namespace: m.Namespace}, secret); err != nil {
+			return nil, err
+		}
+		dialer.tlsConfig = clientTLSConfig(m, secret)
+	}
+	return dialer, nil
+}
+
+// dial connects to the member at addr. A nil dialer connects without TLS nor authentication.
+func (d *memberDialer) dial(addr string, timeout time.Duration) (*memcache.Conn, error) {
+	if d == nil {
+		return memcache.Dial(addr, timeout)
+	}
+	var conn *memcache.Conn
+	var err error
+	if d.tlsConfig != nil {
+		conn, err = memcache.DialTLS(addr, timeout, d.tlsConfig)
+	} else {
+		conn, err = memcache.Dial(addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.credentials != nil {
+		if err := conn.Authenticate(d.credentials.username, d.credentials.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
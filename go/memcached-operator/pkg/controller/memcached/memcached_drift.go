@@ -0,0 +1,123 @@
+package memcached
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// correctDeploymentDrift compares the actual Deployment with the desired one, overwrites
+// the actual fields that drifted and returns their paths. Server-defaulted fields are
+// left alone: scalar fields the operator does not set are skipped, while lists and maps
+// it sets are compared in full. Template annotations added by others, such as the one
+// written by "kubectl rollout restart", are kept.
+func correctDeploymentDrift(desired, actual *appsv1.Deployment) []string {
+	drift := correctDrift("spec.replicas",
+		reflect.ValueOf(&desired.Spec.Replicas).Elem(), reflect.ValueOf(&actual.Spec.Replicas).Elem())
+	return append(drift, correctPodTemplateDrift(&desired.Spec.Template, &actual.Spec.Template)...)
+}
+
+// correctStatefulSetDrift is the StatefulSet counterpart of correctDeploymentDrift.
+func correctStatefulSetDrift(desired, actual *appsv1.StatefulSet) []string {
+	drift := correctDrift("spec.replicas",
+		reflect.ValueOf(&desired.Spec.Replicas).Elem(), reflect.ValueOf(&actual.Spec.Replicas).Elem())
+	return append(drift, correctPodTemplateDrift(&desired.Spec.Template, &actual.Spec.Template)...)
+}
+
+// correctServiceDrift is the Service counterpart of correctDeploymentDrift. The cluster IP, port
+// protocols and target ports defaulted by the API server are left alone.
+func correctServiceDrift(desired, actual *corev1.Service) []string {
+	return correctDrift("spec", reflect.ValueOf(&desired.Spec).Elem(), reflect.ValueOf(&actual.Spec).Elem())
+}
+
+// correctPodTemplateDrift corrects the labels, annotations and spec of the actual pod template.
+func correctPodTemplateDrift(desired, actual *corev1.PodTemplateSpec) []string {
+	drift := correctDrift("spec.template.metadata.labels",
+		reflect.ValueOf(&desired.Labels).Elem(), reflect.ValueOf(&actual.Labels).Elem())
+	for k, v := range desired.Annotations {
+		if actual.Annotations[k] != v {
+			if actual.Annotations == nil {
+				actual.Annotations = map[string]string{}
+			}
+			actual.Annotations[k] = v
+			drift = append(drift, fmt.Sprintf("spec.template.metadata.annotations[%s]", k))
+		}
+	}
+	// The placement fields are not defaulted by the API server, so they are unset when the desired ones are
+	if desired.Spec.Affinity == nil && actual.Spec.Affinity != nil {
+		actual.Spec.Affinity = nil
+		drift = append(drift, "spec.template.spec.affinity")
+	}
+	if desired.Spec.PriorityClassName == "" && actual.Spec.PriorityClassName != "" {
+		actual.Spec.PriorityClassName = ""
+		drift = append(drift, "spec.template.spec.priorityClassName")
+	}
+	return append(drift, correctDrift("spec.template.spec",
+		reflect.ValueOf(&desired.Spec).Elem(), reflect.ValueOf(&actual.Spec).Elem())...)
+}
+
+var quantityType = reflect.TypeOf(resource.Quantity{})
+
+// correctDrift recursively sets the actual value to the desired one where they differ
+// and returns the paths of the drifted fields.
+func correctDrift(path string, desired, actual reflect.Value) []string {
+	if desired.Type() == quantityType {
+		d, a := desired.Interface().(resource.Quantity), actual.Interface().(resource.Quantity)
+		if d.Cmp(a) == 0 {
+			return nil
+		}
+		actual.Set(desired)
+		return []string{path}
+	}
+
+	switch desired.Kind() {
+	case reflect.Ptr:
+		if desired.IsNil() {
+			return nil
+		}
+		if actual.IsNil() {
+			actual.Set(desired)
+			return []string{path}
+		}
+		return correctDrift(path, desired.Elem(), actual.Elem())
+	case reflect.Struct:
+		var drift []string
+		for i := 0; i < desired.NumField(); i++ {
+			field := desired.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			// Unset scalars and structs are left to the API server defaults
+			if kind := field.Type.Kind(); kind != reflect.Slice && kind != reflect.Map && desired.Field(i).IsZero() {
+				continue
+			}
+			fieldPath := path
+			if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+				fieldPath = path + "." + name
+			}
+			drift = append(drift, correctDrift(fieldPath, desired.Field(i), actual.Field(i))...)
+		}
+		return drift
+	case reflect.Slice:
+		if desired.Len() != actual.Len() {
+			actual.Set(desired)
+			return []string{path}
+		}
+		var drift []string
+		for i := 0; i < desired.Len(); i++ {
+			drift = append(drift, correctDrift(fmt.Sprintf("%s[%d]", path, i), desired.Index(i), actual.Index(i))...)
+		}
+		return drift
+	default:
+		if equality.Semantic.DeepEqual(desired.Interface(), actual.Interface()) {
+			return nil
+		}
+		actual.Set(desired)
+		return []string{path}
+	}
+}
@@ -0,0 +1,80 @@
+package memcached
+
+import (
+	"fmt"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// recordScaleEvent records a Normal event on the memcached CR when the replicas of its workload changed.
+func (r *ReconcileMemcached) recordScaleEvent(m *cachev1alpha1.Memcached, kind, name string, from, to *int32) {
+	if from == nil || to == nil || *from == *to {
+		return
+	}
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Scaled", "Scaled %s %s from %d to %d members", kind, name, *from, *to)
+}
+
+// recordSpecWarnings records a Warning event on the memcached CR for every problem of its spec
+// the reconciler works around. Warnings are only recorded for a generation not yet reconciled,
+// so an invalid spec does not flood the events on every resync.
+func (r *ReconcileMemcached) recordSpecWarnings(m *cachev1alpha1.Memcached) {
+	if m.Status.ObservedGeneration == m.Generation {
+		return
+	}
+	for _, warning := range specWarnings(m) {
+		r.recorder.Event(m, corev1.EventTypeWarning, "InvalidSpec", warning)
+	}
+}
+
+// specWarnings returns the problems of the spec of the given memcached CR. No admission
+// webhook validates the spec, so they are only reported once the CR is reconciled.
+func specWarnings(m *cachev1alpha1.Memcached) []string {
+	var warnings []string
+	if autoscaling := m.Spec.Autoscaling; autoscaling != nil {
+		if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+			warnings = append(warnings, fmt.Sprintf("Autoscaling minReplicas %d is greater than maxReplicas %d", *autoscaling.MinReplicas, autoscaling.MaxReplicas))
+		}
+	} else if m.Spec.Size%2 == 0 {
+		warnings = append(warnings, fmt.Sprintf("Cluster size %d is not an odd number", m.Spec.Size))
+	}
+
+	if budget := m.Spec.DisruptionBudget; budget != nil && m.Spec.Size >= 2 {
+		if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+			warnings = append(warnings, "Only one of minAvailable and maxUnavailable can be set, maxUnavailable is ignored")
+		}
+		minAvailable, maxUnavailable := disruptionBudgetForMemcached(m)
+		if relaxed(budget.MinAvailable, minAvailable) || (budget.MinAvailable == nil && relaxed(budget.MaxUnavailable, maxUnavailable)) {
+			warnings = append(warnings, "Disruption budget would block every eviction, it is relaxed to one unavailable member")
+		}
+	}
+
+	cacheMB := m.Spec.CacheMemoryMB()
+	if cacheMB < 1 {
+		warnings = append(warnings, "Cache memory must be at least 1Mi")
+	} else if m.Spec.Resources != nil {
+		if limit, ok := m.Spec.Resources.Limits[corev1.ResourceMemory]; ok {
+			overheadMB := cachev1alpha1.MemoryOverheadMB(cacheMB)
+			if limit.Value() < (cacheMB+overheadMB)*1024*1024 {
+				warnings = append(warnings, fmt.Sprintf("Memory limit %s cannot fit a %dMi cache plus %dMi of overhead", limit.String(), cacheMB, overheadMB))
+			}
+		}
+	}
+
+	if m.Spec.TLSEnabled() {
+		if !cachev1alpha1.VersionAtLeast(m.Spec.Version, cachev1alpha1.MinTLSVersion) {
+			warnings = append(warnings, fmt.Sprintf("TLS requires memcached %s or later, version %s cannot serve it", cachev1alpha1.MinTLSVersion, versionForMemcached(m)))
+		}
+		if d := m.Spec.TLS.CertificateDuration; d != nil && d.Duration < cachev1alpha1.MinCertificateDuration {
+			warnings = append(warnings, fmt.Sprintf("Certificate duration %s is shorter than %s, %s is used", d.Duration, cachev1alpha1.MinCertificateDuration, cachev1alpha1.MinCertificateDuration))
+		}
+	}
+	return append(warnings, m.Spec.ConfigErrors()...)
+}
+
+// relaxed reports whether a requested disruption budget bound was replaced.
+func relaxed(requested, applied *intstr.IntOrString) bool {
+	return requested != nil && applied != nil && *requested != *applied
+}
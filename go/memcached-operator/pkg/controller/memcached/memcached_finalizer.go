@@ -0,0 +1,194 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// memcachedFinalizer holds a deleted memcached CR until its teardown completed
+	memcachedFinalizer = "cache.example.com/teardown"
+	// teardownRetryPeriod is how long to wait before retrying a failed teardown
+	teardownRetryPeriod = 5 * time.Second
+	// flushMemberTimeout is how long a member has to answer the flush_all command
+	flushMemberTimeout = 5 * time.Second
+)
+
+// hasFinalizer reports whether the teardown finalizer is set on the given memcached CR.
+func hasFinalizer(m *cachev1alpha1.Memcached) bool {
+	for _, f := range m.GetFinalizers() {
+		if f == memcachedFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownTimeout returns how long the teardown of the given memcached CR may take.
+func teardownTimeout(m *cachev1alpha1.Memcached) time.Duration {
+	if m.Spec.TeardownTimeoutSeconds > 0 {
+		return time.Duration(m.Spec.TeardownTimeoutSeconds) * time.Second
+	}
+	return cachev1alpha1.DefaultTeardownTimeoutSeconds * time.Second
+}
+
+// finalizeMemcached runs the teardown of a deleted memcached CR, then removes its finalizer so
+// the CR and the objects it owns are garbage collected. A failed teardown is retried until the
+// teardown timeout passed since the deletion, then the CR is released with the remaining steps skipped.
+func (r *ReconcileMemcached) finalizeMemcached(reqLogger logr.Logger, m *cachev1alpha1.Memcached) (reconcile.Result, error) {
+	if !hasFinalizer(m) {
+		return reconcile.Result{}, nil
+	}
+	if err := r.teardownMemcached(reqLogger, m); err != nil {
+		timeout := teardownTimeout(m)
+		left := m.GetDeletionTimestamp().Add(timeout).Sub(time.Now())
+		if left > 0 {
+			reqLogger.Error(err, "Failed to tear down Memcached, retrying.")
+			r.recorder.Eventf(m, corev1.EventTypeWarning, "TeardownFailed", "Failed to tear down: %v", err)
+			if left > teardownRetryPeriod {
+				left = teardownRetryPeriod
+			}
+			return reconcile.Result{RequeueAfter: left}, nil
+		}
+		reqLogger.Error(err, "Memcached teardown timed out, releasing it.")
+		r.recorder.Eventf(m, corev1.EventTypeWarning, "TeardownTimedOut", "Teardown did not complete within %s, skipping it: %v", timeout, err)
+	}
+
+	controllerutil.RemoveFinalizer(m, memcachedFinalizer)
+	if err := r.client.Update(context.TODO(), m); err != nil {
+		reqLogger.Error(err, "Failed to remove finalizer.")
+		return reconcile.Result{}, err
+	}
+	reqLogger.Info("Released deleted Memcached.")
+	return reconcile.Result{}, nil
+}
+
+// teardownMemcached flushes the members of the given memcached CR when its deletion policy asks
+// for it, then removes the connection info published for it.
+func (r *ReconcileMemcached) teardownMemcached(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	if m.Spec.DeletionPolicy == cachev1alpha1.DeletionPolicyFlush {
+		dialer, err := dialerForMemcached(context.TODO(), r.apiReader, m)
+		if err != nil {
+			return err
+		}
+		podList := &corev1.PodList{}
+		if err := r.client.List(context.TODO(), podList, client.InNamespace(m.Namespace), client.MatchingLabels(labelsForMemcached(m.Name))); err != nil {
+			return err
+		}
+		var addrs []string
+		for _, pod := range podList.Items {
+			if pod.Status.PodIP != "" && pod.DeletionTimestamp == nil {
+				addrs = append(addrs, net.JoinHostPort(pod.Status.PodIP, "11211"))
+			}
+		}
+		if err := flushMembers(addrs, flushMemberTimeout, dialer); err != nil {
+			return err
+		}
+		reqLogger.Info("Flushed Memcached members.", "Members", len(addrs))
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Flushed", "Flushed %d members", len(addrs))
+	}
+	return r.deleteConnectionInfo(reqLogger, m)
+}
+
+// flushMembers invalidates every item cached by the members at the given addresses, concurrently,
+// connecting to them with the given dialer.
+func flushMembers(addrs []string, timeout time.Duration, dialer *memberDialer) error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := flushMember(addr, timeout, dialer); err != nil {
+				mu.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", addr, err))
+				mu.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to flush members: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// flushMember invalidates every item cached by the member at the given address.
+func flushMember(addr string, timeout time.Duration, dialer *memberDialer) error {
+	conn, err := dialer.dial(addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.FlushAll()
+}
+
+// connectionInfoLabels returns the labels of the Secrets and ConfigMaps publishing how to connect
+// to the given memcached CR. They are matched by labels rather than owner references, so copies
+// published by other tools are removed too.
+func connectionInfoLabels(m *cachev1alpha1.Memcached) map[string]string {
+	return map[string]string{
+		"cache.example.com/memcached-name":      m.Name,
+		"cache.example.com/memcached-namespace": m.Namespace,
+	}
+}
+
+// deleteConnectionInfo deletes the Secrets and ConfigMaps publishing how to connect to the given
+// memcached CR in its namespace, the only one the operator is granted access to. They are listed
+// from the API server, so the operator does not cache every Secret of the namespace.
+func (r *ReconcileMemcached) deleteConnectionInfo(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	secrets := &corev1.SecretList{}
+	if err := r.apiReader.List(context.TODO(), secrets, client.InNamespace(m.Namespace), client.MatchingLabels(connectionInfoLabels(m))); err != nil {
+		return err
+	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.apiReader.List(context.TODO(), configMaps, client.InNamespace(m.Namespace), client.MatchingLabels(connectionInfoLabels(m))); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		if err := r.deleteConnectionInfoObject(reqLogger, m, "Secret", &secrets.Items[i]); err != nil {
+			return err
+		}
+	}
+	for i := range configMaps.Items {
+		if err := r.deleteConnectionInfoObject(reqLogger, m, "ConfigMap", &configMaps.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteConnectionInfoObject deletes a Secret or ConfigMap publishing connection info of the given memcached CR.
+func (r *ReconcileMemcached) deleteConnectionInfoObject(reqLogger logr.Logger, m *cachev1alpha1.Memcached, kind string, obj interface {
+	metav1.Object
+	runtime.Object
+}) error {
+	reqLogger.Info("Deleting connection info.", kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+	if err := r.client.Delete(context.TODO(), obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	recordOperation(kind, "delete")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted connection info %s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+	return nil
+}
@@ -0,0 +1,118 @@
+package memcached
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileHorizontalPodAutoscaler creates or updates the HorizontalPodAutoscaler of the given
+// memcached CR when autoscaling is enabled in the spec, and deletes the one owned by the CR when
+// it is not. The autoscaler scales the CR itself through its scale subresource.
+func (r *ReconcileMemcached) reconcileHorizontalPodAutoscaler(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Autoscaling == nil {
+			return nil
+		}
+		hpa := r.horizontalPodAutoscalerForMemcached(m)
+		reqLogger.Info("Creating a new HorizontalPodAutoscaler.", "HorizontalPodAutoscaler.Namespace", hpa.Namespace, "HorizontalPodAutoscaler.Name", hpa.Name)
+		if err := r.client.Create(context.TODO(), hpa); err != nil {
+			return err
+		}
+		recordOperation("HorizontalPodAutoscaler", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created HorizontalPodAutoscaler %s", hpa.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Autoscaling == nil {
+		reqLogger.Info("Deleting the HorizontalPodAutoscaler.", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+		if err := r.client.Delete(context.TODO(), found); err != nil {
+			return err
+		}
+		recordOperation("HorizontalPodAutoscaler", "delete")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted HorizontalPodAutoscaler %s", found.Name)
+		return nil
+	}
+
+	desired := r.horizontalPodAutoscalerForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	reqLogger.Info("Updating the HorizontalPodAutoscaler.", "HorizontalPodAutoscaler.Namespace", found.Namespace, "HorizontalPodAutoscaler.Name", found.Name)
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		return err
+	}
+	recordOperation("HorizontalPodAutoscaler", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated HorizontalPodAutoscaler %s", found.Name)
+	return nil
+}
+
+// horizontalPodAutoscalerForMemcached returns a HorizontalPodAutoscaler object scaling the given memcached CR
+func (r *ReconcileMemcached) horizontalPodAutoscalerForMemcached(m *cachev1alpha1.Memcached) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	autoscaling := m.Spec.Autoscaling
+	minReplicas := int32(1)
+	if autoscaling.MinReplicas != nil {
+		minReplicas = *autoscaling.MinReplicas
+	}
+	var metrics []autoscalingv2beta2.MetricSpec
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	if len(metrics) == 0 {
+		metrics = append(metrics, resourceMetricForMemcached(corev1.ResourceCPU, cachev1alpha1.DefaultTargetCPUUtilizationPercentage))
+	}
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: cachev1alpha1.SchemeGroupVersion.String(),
+				Kind:       "Memcached",
+				Name:       m.Name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	controllerutil.SetControllerReference(m, hpa, r.scheme)
+	return hpa
+}
+
+// resourceMetricForMemcached returns an autoscaler metric targeting the given average
+// utilization of a resource of the memcached pods.
+func resourceMetricForMemcached(name corev1.ResourceName, utilization int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
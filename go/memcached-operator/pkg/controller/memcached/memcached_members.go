@@ -0,0 +1,69 @@
+package memcached
+
+import (
+	"context"
+	"sort"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// membersForPods returns the member status of every memcached pod, ordered by pod name.
+func (r *ReconcileMemcached) membersForPods(ctx context.Context, pods []corev1.Pod) []cachev1alpha1.MemberStatus {
+	zones := map[string]string{}
+	members := make([]cachev1alpha1.MemberStatus, 0, len(pods))
+	for _, pod := range pods {
+		member := memberForPod(&pod)
+		if pod.Spec.NodeName != "" {
+			zone, ok := zones[pod.Spec.NodeName]
+			if !ok {
+				zone = r.zoneForNode(ctx, pod.Spec.NodeName)
+				zones[pod.Spec.NodeName] = zone
+			}
+			member.Zone = zone
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// zoneForNode returns the topology zone label of the named node, or an empty
+// string when the node cannot be read.
+func (r *ReconcileMemcached) zoneForNode(ctx context.Context, name string) string {
+	node := &corev1.Node{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+		log.V(1).Info("Failed to get Node for member zone.", "Node.Name", name, "error", err.Error())
+		return ""
+	}
+	if zone, ok := node.Labels[corev1.LabelZoneFailureDomainStable]; ok {
+		return zone
+	}
+	return node.Labels[corev1.LabelZoneFailureDomain]
+}
+
+// memberForPod returns the member status of a memcached pod, without its zone.
+func memberForPod(pod *corev1.Pod) cachev1alpha1.MemberStatus {
+	member := cachev1alpha1.MemberStatus{
+		Name:     pod.Name,
+		PodIP:    pod.Status.PodIP,
+		NodeName: pod.Spec.NodeName,
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			member.Ready = c.Status == corev1.ConditionTrue
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != "memcached" {
+			continue
+		}
+		member.RestartCount = cs.RestartCount
+		if cs.LastTerminationState.Terminated != nil {
+			member.LastTerminationReason = cs.LastTerminationState.Terminated.Reason
+		}
+	}
+	return member
+}
@@ -0,0 +1,114 @@
+package memcached
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// operatorPodLabels are the labels of the operator pod in deploy/operator.yaml. The operator
+// watches the namespace it runs in, so its pod is selected in the namespace of the Memcached.
+var operatorPodLabels = map[string]string{"name": "memcached-operator"}
+
+// reconcileNetworkPolicy creates or updates the NetworkPolicy admitting the clients of the given
+// memcached CR, and deletes the one owned by the CR when access is not restricted.
+func (r *ReconcileMemcached) reconcileNetworkPolicy(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &networkingv1.NetworkPolicy{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Access == nil {
+			return nil
+		}
+		policy := r.networkPolicyForMemcached(m)
+		reqLogger.Info("Creating a new NetworkPolicy.", "NetworkPolicy.Namespace", policy.Namespace, "NetworkPolicy.Name", policy.Name)
+		if err := r.client.Create(context.TODO(), policy); err != nil {
+			return err
+		}
+		recordOperation("NetworkPolicy", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created NetworkPolicy %s", policy.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Access == nil {
+		reqLogger.Info("Deleting the NetworkPolicy.", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+		if err := r.client.Delete(context.TODO(), found); err != nil {
+			return err
+		}
+		recordOperation("NetworkPolicy", "delete")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted NetworkPolicy %s", found.Name)
+		return nil
+	}
+
+	desired := r.networkPolicyForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	reqLogger.Info("Updating the NetworkPolicy.", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		return err
+	}
+	recordOperation("NetworkPolicy", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated NetworkPolicy %s", found.Name)
+	return nil
+}
+
+// networkPolicyForMemcached returns a NetworkPolicy only admitting the clients selected by the
+// access of the given memcached CR on the memcached port, and the operator while it connects to
+// the members.
+func (r *ReconcileMemcached) networkPolicyForMemcached(m *cachev1alpha1.Memcached) *networkingv1.NetworkPolicy {
+	clients := networkingv1.NetworkPolicyPeer{
+		PodSelector:       m.Spec.Access.PodSelector,
+		NamespaceSelector: m.Spec.Access.NamespaceSelector,
+	}
+	if clients.PodSelector == nil && clients.NamespaceSelector == nil {
+		clients.PodSelector = &metav1.LabelSelector{}
+	}
+	peers := []networkingv1.NetworkPolicyPeer{clients}
+	if operatorConnects(m) {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{MatchLabels: operatorPodLabels},
+		})
+	}
+	protocol := corev1.ProtocolTCP
+	port := intstr.FromInt(11211)
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: labelsForMemcached(m.Name),
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+				From:  peers,
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	controllerutil.SetControllerReference(m, policy, r.scheme)
+	return policy
+}
+
+// operatorConnects reports whether the operator connects to the members of the given memcached CR,
+// to probe them or to flush them on deletion.
+func operatorConnects(m *cachev1alpha1.Memcached) bool {
+	return m.Spec.Probe != nil || m.Spec.DeletionPolicy == cachev1alpha1.DeletionPolicyFlush
+}
@@ -0,0 +1,83 @@
+package memcached
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// observeMembers returns the state of the members of the given paused memcached CR, without
+// creating or updating any object.
+func (r *ReconcileMemcached) observeMembers(reqLogger logr.Logger, m *cachev1alpha1.Memcached) (*memberState, error) {
+	workload, err := r.observeWorkload(m)
+	if err != nil {
+		return nil, err
+	}
+	// The Secrets the operator authenticates with may be missing or edited by hand while paused,
+	// the members are then probed without them and reported unreachable
+	dialer, err := dialerForMemcached(context.TODO(), r.apiReader, m)
+	if err != nil {
+		reqLogger.Info("Failed to read the member credentials, probing without them.", "error", err.Error())
+		dialer = nil
+	}
+	return &memberState{workload: workload, dialer: dialer}, nil
+}
+
+// observeWorkload returns the rollout state of the Deployment or StatefulSet running the members
+// of the given memcached CR, or the state of a workload without members when it does not exist.
+func (r *ReconcileMemcached) observeWorkload(m *cachev1alpha1.Memcached) (*workloadStatus, error) {
+	key := types.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+	if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		sts := &appsv1.StatefulSet{}
+		if err := r.client.Get(context.TODO(), key, sts); err == nil {
+			return statefulSetWorkloadStatus(sts), nil
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &workloadStatus{kind: "StatefulSet", replicas: m.Spec.Size}, nil
+	}
+	dep := &appsv1.Deployment{}
+	if err := r.client.Get(context.TODO(), key, dep); err == nil {
+		return deploymentWorkloadStatus(dep), nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return &workloadStatus{kind: "Deployment", replicas: m.Spec.Size}, nil
+}
+
+// setPausedCondition sets the Paused condition of the memcached status.
+func setPausedCondition(status *cachev1alpha1.MemcachedStatus, paused bool, generation int64) {
+	condition := cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "Reconciling",
+		Message:            "The operator reconciles the owned objects",
+	}
+	if paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "PausedAnnotation"
+		condition.Message = "The " + cachev1alpha1.PausedAnnotation + " annotation is set, the owned objects are left alone"
+	}
+	status.SetCondition(condition)
+}
+
+// recordPauseTransition emits an event when the given memcached CR enters or leaves the paused
+// state reported in its status.
+func (r *ReconcileMemcached) recordPauseTransition(m *cachev1alpha1.Memcached, paused bool) {
+	if paused == m.Status.IsConditionTrue(cachev1alpha1.ConditionPaused) {
+		return
+	}
+	if paused {
+		r.recorder.Event(m, corev1.EventTypeNormal, "Paused", "Paused the reconciliation of the owned objects")
+	} else {
+		r.recorder.Event(m, corev1.EventTypeNormal, "Resumed", "Resumed the reconciliation of the owned objects")
+	}
+}
@@ -0,0 +1,110 @@
+package memcached
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcilePodDisruptionBudget creates or updates the PodDisruptionBudget of the given memcached CR.
+// A single member cannot be protected without blocking node drains forever, so the budget owned
+// by the CR is deleted while the cluster has fewer than two members.
+func (r *ReconcileMemcached) reconcilePodDisruptionBudget(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	found := &policyv1beta1.PodDisruptionBudget{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		if m.Spec.Size < 2 {
+			return nil
+		}
+		pdb := r.podDisruptionBudgetForMemcached(m)
+		reqLogger.Info("Creating a new PodDisruptionBudget.", "PodDisruptionBudget.Namespace", pdb.Namespace, "PodDisruptionBudget.Name", pdb.Name)
+		if err := r.client.Create(context.TODO(), pdb); err != nil {
+			return err
+		}
+		recordOperation("PodDisruptionBudget", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created PodDisruptionBudget %s", pdb.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil
+	}
+	if m.Spec.Size < 2 {
+		reqLogger.Info("Deleting the PodDisruptionBudget.", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+		if err := r.client.Delete(context.TODO(), found); err != nil {
+			return err
+		}
+		recordOperation("PodDisruptionBudget", "delete")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted PodDisruptionBudget %s", found.Name)
+		return nil
+	}
+
+	desired := r.podDisruptionBudgetForMemcached(m)
+	if equality.Semantic.DeepEqual(desired.Spec, found.Spec) {
+		return nil
+	}
+	found.Spec = desired.Spec
+	reqLogger.Info("Updating the PodDisruptionBudget.", "PodDisruptionBudget.Namespace", found.Namespace, "PodDisruptionBudget.Name", found.Name)
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		return err
+	}
+	recordOperation("PodDisruptionBudget", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated PodDisruptionBudget %s", found.Name)
+	return nil
+}
+
+// podDisruptionBudgetForMemcached returns a memcached PodDisruptionBudget object
+func (r *ReconcileMemcached) podDisruptionBudgetForMemcached(m *cachev1alpha1.Memcached) *policyv1beta1.PodDisruptionBudget {
+	minAvailable, maxUnavailable := disruptionBudgetForMemcached(m)
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labelsForMemcached(m.Name),
+			},
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	controllerutil.SetControllerReference(m, pdb, r.scheme)
+	return pdb
+}
+
+// disruptionBudgetForMemcached returns the minAvailable or maxUnavailable bound of the
+// PodDisruptionBudget of the given memcached CR, defaulting to one unavailable member.
+// A bound that would forbid every eviction is relaxed to let one member go at a time.
+func disruptionBudgetForMemcached(m *cachev1alpha1.Memcached) (*intstr.IntOrString, *intstr.IntOrString) {
+	size := int(m.Spec.Size)
+	one := intstr.FromInt(1)
+	budget := m.Spec.DisruptionBudget
+	switch {
+	case budget != nil && budget.MinAvailable != nil:
+		minAvailable := *budget.MinAvailable
+		if n, err := intstr.GetValueFromIntOrPercent(&minAvailable, size, true); err != nil || n >= size {
+			minAvailable = intstr.FromInt(size - 1)
+		}
+		return &minAvailable, nil
+	case budget != nil && budget.MaxUnavailable != nil:
+		maxUnavailable := *budget.MaxUnavailable
+		if n, err := intstr.GetValueFromIntOrPercent(&maxUnavailable, size, true); err != nil || n < 1 {
+			maxUnavailable = one
+		}
+		return nil, &maxUnavailable
+	}
+	return nil, &one
+}
@@ -0,0 +1,124 @@
+package memcached
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// probeMembers probes the given members of the memcached CR over the memcached protocol when
+// probing is enabled, carrying over the last results of the members whose probe is not due yet.
+// The operator connects to them with the given dialer.
+// It returns how long to wait until the next probe is due, or zero when probing is disabled.
+func probeMembers(reqLogger logr.Logger, m *cachev1alpha1.Memcached, members []cachev1alpha1.MemberStatus, dialer *memberDialer) time.Duration {
+	if m.Spec.Probe == nil {
+		return 0
+	}
+	period, timeout := probeTimings(m.Spec.Probe)
+	previous := map[string]cachev1alpha1.MemberStatus{}
+	for _, member := range m.Status.Members {
+		previous[member.Name] = member
+	}
+
+	now := time.Now()
+	next := period
+	var wg sync.WaitGroup
+	for i := range members {
+		member := &members[i]
+		if last, ok := previous[member.Name]; ok && last.LastProbeTime != nil {
+			member.Reachable = last.Reachable
+			member.Version = last.Version
+			member.UptimeSeconds = last.UptimeSeconds
+			member.LastProbeTime = last.LastProbeTime
+			if due := last.LastProbeTime.Add(period).Sub(now); due > 0 {
+				if due < next {
+					next = due
+				}
+				continue
+			}
+		}
+		if member.PodIP == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := probeMember(member, timeout, now, dialer); err != nil {
+				reqLogger.V(1).Info("Member did not answer the memcached probe.", "Pod.Name", member.Name, "error", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	return next
+}
+
+// probeMember asks a member for its version and uptime, recording whether it answered.
+func probeMember(member *cachev1alpha1.MemberStatus, timeout time.Duration, now time.Time, dialer *memberDialer) error {
+	probeTime := metav1.NewTime(now)
+	reachable := false
+	member.LastProbeTime = &probeTime
+	member.Reachable = &reachable
+	member.Version = ""
+	member.UptimeSeconds = 0
+
+	conn, err := dialer.dial(net.JoinHostPort(member.PodIP, "11211"), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	version, err := conn.Version()
+	if err != nil {
+		return err
+	}
+	stats, err := conn.Stats()
+	if err != nil {
+		return err
+	}
+	uptime, _ := stats.Uint("uptime")
+
+	reachable = true
+	member.Version = version
+	member.UptimeSeconds = int64(uptime)
+	return nil
+}
+
+// probeTimings returns the period and timeout of the given member probe.
+func probeTimings(probe *cachev1alpha1.Probe) (time.Duration, time.Duration) {
+	period := time.Duration(cachev1alpha1.DefaultProbePeriodSeconds) * time.Second
+	if probe.PeriodSeconds > 0 {
+		period = time.Duration(probe.PeriodSeconds) * time.Second
+	}
+	timeout := time.Duration(cachev1alpha1.DefaultProbeTimeoutSeconds) * time.Second
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	return period, timeout
+}
+
+// setMembersDegraded sets the Degraded condition when ready members did not answer their
+// last probe, unless the memcached status is already Degraded because of its workload.
+func setMembersDegraded(status *cachev1alpha1.MemcachedStatus, generation int64) {
+	var unreachable []string
+	for _, member := range status.Members {
+		if member.Ready && member.Reachable != nil && !*member.Reachable {
+			unreachable = append(unreachable, member.Name)
+		}
+	}
+	if len(unreachable) == 0 || status.IsConditionTrue(cachev1alpha1.ConditionDegraded) {
+		return
+	}
+	status.SetCondition(cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "MembersUnreachable",
+		Message:            fmt.Sprintf("%d/%d members did not answer memcached requests: %s", len(unreachable), len(status.Members), strings.Join(unreachable, ", ")),
+	})
+}
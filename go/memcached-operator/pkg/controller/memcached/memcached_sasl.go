@@ -0,0 +1,322 @@
+package memcached
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// saslDir is where the SASL Secret is mounted in the memcached container
+	saslDir = "/etc/memcached/sasl"
+	// saslDatabaseKey is the key of the SASL Secret holding the password database, one user:password per line
+	saslDatabaseKey = "memcached-sasl-pwdb"
+	// saslConfigKey is the key of the SASL Secret holding the SASL configuration of memcached
+	saslConfigKey = "memcached.conf"
+	// saslOperatorPasswordKey is the key of the SASL Secret holding the password of the operator
+	saslOperatorPasswordKey = "operator-password"
+	// operatorUsername is the SASL username the operator probes, collects the stats of and flushes the members with
+	operatorUsername = "memcached-operator"
+	// secretResyncPeriod is how often the password and certificate Secrets are read again. They are
+	// not watched, so the operator does not cache every Secret of the namespace.
+	secretResyncPeriod = time.Minute
+)
+
+// memberCredentials are the SASL credentials the operator authenticates to the members with
+type memberCredentials struct {
+	username string
+	password string
+}
+
+// saslConfig is the SASL database rendered for a memcached CR
+type saslConfig struct {
+	// hash identifies the content of the database
+	hash string
+	// users are the usernames of the MemcachedUsers in the database, sorted
+	users []string
+	// credentials are the credentials of the operator, also in the database
+	credentials *memberCredentials
+}
+
+// saslUser is a MemcachedUser referencing a memcached CR, with its resolved credentials
+type saslUser struct {
+	user     *cachev1alpha1.MemcachedUser
+	username string
+	password string
+	// problem explains why the user cannot be added to the database, empty when it can
+	problem string
+}
+
+// saslSecretName returns the name of the Secret holding the SASL database of the given memcached CR name.
+func saslSecretName(name string) string {
+	return name + "-sasl"
+}
+
+// reconcileSASL renders the SASL database of the given memcached CR from the MemcachedUsers
+// referencing it into a Secret mounted by the members. It returns the rendered database, or nil
+// when SASL is disabled, and the users referencing the CR.
+func (r *ReconcileMemcached) reconcileSASL(reqLogger logr.Logger, m *cachev1alpha1.Memcached) (*saslConfig, []saslUser, error) {
+	users, err := r.usersForMemcached(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := &corev1.Secret{}
+	err = r.apiReader.Get(context.TODO(), types.NamespacedName{Name: saslSecretName(m.Name), Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, err
+	}
+	exists := err == nil
+	if exists && !metav1.IsControlledBy(found, m) {
+		return nil, nil, fmt.Errorf("secret %s already exists and is not owned by the Memcached", found.Name)
+	}
+
+	if !m.Spec.SASLEnabled() {
+		if exists {
+			reqLogger.Info("Deleting the SASL Secret.", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+			if err := r.client.Delete(context.TODO(), found); err != nil && !errors.IsNotFound(err) {
+				return nil, nil, err
+			}
+			recordOperation("Secret", "delete")
+			r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted SASL Secret %s", found.Name)
+		}
+		return nil, users, nil
+	}
+
+	// Keep the password of the operator across updates, the members running with it would reject a new one
+	password := string(found.Data[saslOperatorPasswordKey])
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return nil, nil, err
+		}
+	}
+	secret := r.saslSecretForMemcached(m, users, password)
+	if !exists {
+		reqLogger.Info("Creating a new SASL Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Create(context.TODO(), secret); err != nil {
+			return nil, nil, err
+		}
+		recordOperation("Secret", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created SASL Secret %s", secret.Name)
+	} else if !reflect.DeepEqual(found.Data, secret.Data) {
+		found.Data = secret.Data
+		reqLogger.Info("Updating the SASL users.", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+		if err := r.client.Update(context.TODO(), found); err != nil {
+			return nil, nil, err
+		}
+		recordOperation("Secret", "update")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated SASL Secret %s", found.Name)
+	}
+
+	config := &saslConfig{
+		hash:        saslHash(secret.Data),
+		credentials: &memberCredentials{username: operatorUsername, password: password},
+	}
+	for _, u := range users {
+		if u.problem == "" {
+			config.users = append(config.users, u.username)
+		}
+	}
+	sort.Strings(config.users)
+	return config, users, nil
+}
+
+// usersForMemcached returns the MemcachedUsers referencing the given memcached CR, ordered by name,
+// with their passwords read from their Secrets on the API server.
+func (r *ReconcileMemcached) usersForMemcached(m *cachev1alpha1.Memcached) ([]saslUser, error) {
+	userList := &cachev1alpha1.MemcachedUserList{}
+	if err := r.client.List(context.TODO(), userList, client.InNamespace(m.Namespace)); err != nil {
+		return nil, err
+	}
+	sort.Slice(userList.Items, func(i, j int) bool { return userList.Items[i].Name < userList.Items[j].Name })
+
+	var users []saslUser
+	owners := map[string]string{operatorUsername: ""}
+	for i := range userList.Items {
+		user := &userList.Items[i]
+		if user.Spec.MemcachedName != m.Name || user.DeletionTimestamp != nil {
+			continue
+		}
+		u := saslUser{user: user, username: user.SASLUsername()}
+		users = append(users, u)
+		current := &users[len(users)-1]
+		if owner, ok := owners[u.username]; ok {
+			if owner == "" {
+				current.problem = fmt.Sprintf("Username %s is reserved for the operator", u.username)
+			} else {
+				current.problem = fmt.Sprintf("Username %s is already used by MemcachedUser %s", u.username, owner)
+			}
+			continue
+		}
+		if strings.ContainsAny(u.username, ": \t\r\n") {
+			current.problem = fmt.Sprintf("Username %q cannot contain a colon or whitespace", u.username)
+			continue
+		}
+		owners[u.username] = user.Name
+
+		ref := user.Spec.PasswordSecret
+		secret := &corev1.Secret{}
+		err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: user.Namespace}, secret)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, err
+			}
+			current.problem = fmt.Sprintf("Password Secret %s not found", ref.Name)
+			continue
+		}
+		password := string(secret.Data[ref.Key])
+		switch {
+		case password == "":
+			current.problem = fmt.Sprintf("Password Secret %s has no key %s", ref.Name, ref.Key)
+		case strings.ContainsAny(password, "\r\n"):
+			current.problem = fmt.Sprintf("Password in key %s of Secret %s cannot contain a line break", ref.Key, ref.Name)
+		default:
+			current.password = password
+		}
+	}
+	return users, nil
+}
+
+// saslSecretForMemcached returns the Secret holding the SASL configuration and database of the
+// given memcached CR, with the valid users and the operator.
+func (r *ReconcileMemcached) saslSecretForMemcached(m *cachev1alpha1.Memcached, users []saslUser, operatorPassword string) *corev1.Secret {
+	var database strings.Builder
+	database.WriteString(operatorUsername + ":" + operatorPassword + "\n")
+	for _, u := range users {
+		if u.problem == "" {
+			database.WriteString(u.username + ":" + u.password + "\n")
+		}
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      saslSecretName(m.Name),
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Data: map[string][]byte{
+			saslConfigKey:           []byte("mech_list: plain\n"),
+			saslDatabaseKey:         []byte(database.String()),
+			saslOperatorPasswordKey: []byte(operatorPassword),
+		},
+	}
+	// Set Memcached instance as the owner of the Secret.
+	controllerutil.SetControllerReference(m, secret, r.scheme)
+	return secret
+}
+
+// saslHash returns a digest of the given SASL Secret data.
+func saslHash(data map[string][]byte) string {
+	return dataHash(data, saslConfigKey, saslDatabaseKey)
+}
+
+// dataHash returns a digest of the values of the given keys in the Secret data.
+func dataHash(data map[string][]byte, keys ...string) string {
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(data[key])
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// generatePassword returns a random password.
+func generatePassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// addSASLToPodSpec mounts the SASL Secret of the given memcached CR into the memcached container
+// and enables SASL authentication.
+func addSASLToPodSpec(m *cachev1alpha1.Memcached, spec *corev1.PodSpec) {
+	container := &spec.Containers[0]
+	container.Command = append(container.Command, "-S")
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "SASL_CONF_PATH", Value: saslDir},
+		corev1.EnvVar{Name: "MEMCACHED_SASL_PWDB", Value: saslDir + "/" + saslDatabaseKey},
+	)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "sasl",
+		MountPath: saslDir,
+		ReadOnly:  true,
+	})
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "sasl",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: saslSecretName(m.Name),
+				Items: []corev1.KeyToPath{
+					{Key: saslConfigKey, Path: saslConfigKey},
+					{Key: saslDatabaseKey, Path: saslDatabaseKey},
+				},
+			},
+		},
+	})
+}
+
+// updateUserStatuses sets whether the members of the given memcached CR accept each user referencing it.
+func (r *ReconcileMemcached) updateUserStatuses(reqLogger logr.Logger, m *cachev1alpha1.Memcached, users []saslUser, activeUsers []string) error {
+	active := map[string]bool{}
+	for _, username := range activeUsers {
+		active[username] = true
+	}
+	for _, u := range users {
+		status := cachev1alpha1.MemcachedUserStatus{}
+		switch {
+		case !m.Spec.SASLEnabled():
+			status.Message = fmt.Sprintf("SASL authentication is not enabled on Memcached %s", m.Name)
+		case u.problem != "":
+			status.Message = u.problem
+		case active[u.username]:
+			status.Active = true
+		default:
+			status.Message = "Waiting for the members to be rolled out with the user"
+		}
+		if reflect.DeepEqual(u.user.Status, status) {
+			continue
+		}
+		if u.problem != "" && status.Message == u.problem {
+			r.recorder.Event(u.user, corev1.EventTypeWarning, "InvalidUser", u.problem)
+		}
+		u.user.Status = status
+		if err := r.client.Status().Update(context.TODO(), u.user); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		reqLogger.Info("Updated MemcachedUser status.", "MemcachedUser.Name", u.user.Name, "Active", status.Active)
+	}
+	return nil
+}
+
+// memcachedForUser maps a MemcachedUser to a request for the memcached CR it references.
+func memcachedForUser(a handler.MapObject) []reconcile.Request {
+	user, ok := a.Object.(*cachev1alpha1.MemcachedUser)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: user.Spec.MemcachedName, Namespace: user.Namespace}}}
+}
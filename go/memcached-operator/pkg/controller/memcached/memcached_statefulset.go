@@ -0,0 +1,88 @@
+package memcached
+
+import (
+	"context"
+	"strings"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileStatefulSet creates the memcached StatefulSet or corrects its drift, and returns its rollout state.
+// It returns true when the request must be requeued to observe the StatefulSet after a change.
+func (r *ReconcileMemcached) reconcileStatefulSet(reqLogger logr.Logger, memcached *cachev1alpha1.Memcached, config *podConfig) (*workloadStatus, bool, error) {
+	// Check if the StatefulSet already exists, if not create a new one
+	found := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: memcached.Name, Namespace: memcached.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Define a new StatefulSet
+		sts := r.statefulSetForMemcached(memcached, config)
+		reqLogger.Info("Creating a new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		err = r.client.Create(context.TODO(), sts)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "CreateFailed", "Failed to create StatefulSet %s: %v", sts.Name, err)
+			return nil, false, err
+		}
+		recordOperation("StatefulSet", "create")
+		r.recorder.Eventf(memcached, corev1.EventTypeNormal, "Created", "Created StatefulSet %s", sts.Name)
+		// StatefulSet created successfully - return and requeue
+		return nil, true, nil
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get StatefulSet.")
+		return nil, false, err
+	}
+
+	// Ensure the StatefulSet matches the spec, reverting manual edits of the fields the operator manages
+	original := found.DeepCopy()
+	if drift := correctStatefulSetDrift(r.statefulSetForMemcached(memcached, config), found); len(drift) > 0 {
+		reqLogger.Info("Correcting StatefulSet drift.", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name, "Fields", drift)
+		err = r.client.Patch(context.TODO(), found, client.MergeFrom(original))
+		if err != nil {
+			reqLogger.Error(err, "Failed to patch StatefulSet.", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			r.recorder.Eventf(memcached, corev1.EventTypeWarning, "UpdateFailed", "Failed to update StatefulSet %s: %v", found.Name, err)
+			return nil, false, err
+		}
+		recordOperation("StatefulSet", "update")
+		recordScale(original.Spec.Replicas, found.Spec.Replicas)
+		r.recordScaleEvent(memcached, "StatefulSet", found.Name, original.Spec.Replicas, found.Spec.Replicas)
+		r.recorder.Eventf(memcached, corev1.EventTypeNormal, "DriftCorrected", "Corrected StatefulSet %s fields: %s", found.Name, strings.Join(drift, ", "))
+	}
+
+	return statefulSetWorkloadStatus(found), false, nil
+}
+
+// statefulSetForMemcached returns a memcached StatefulSet object. Its pods get stable names
+// and DNS records through the governing headless Service.
+func (r *ReconcileMemcached) statefulSetForMemcached(m *cachev1alpha1.Memcached, config *podConfig) *appsv1.StatefulSet {
+	ls := labelsForMemcached(m.Name)
+	replicas := m.Spec.Size
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Name,
+			Namespace: m.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceName(m.Name),
+			// Members do not depend on each other, so they can start and stop together
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ls,
+			},
+			Template: podTemplateForMemcached(m, config),
+		},
+	}
+	// Set Memcached instance as the owner and controller
+	controllerutil.SetControllerReference(m, sts, r.scheme)
+	return sts
+}
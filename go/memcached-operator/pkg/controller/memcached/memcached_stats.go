@@ -0,0 +1,175 @@
+package memcached
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+	"github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/memcache"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// statsConcurrency is the most members queried at once while collecting their statistics
+	statsConcurrency = 16
+	// statsMemberTimeout is how long a member has to answer the stats command
+	statsMemberTimeout = time.Second
+	// statsCollectTimeout bounds a whole collection, members not queried by then are skipped
+	statsCollectTimeout = 10 * time.Second
+)
+
+var (
+	statsLabels = []string{"namespace", "memcached", "pod"}
+
+	memberUpDesc = prometheus.NewDesc("memcached_up",
+		"Whether the memcached member answered the stats command.", statsLabels, nil)
+
+	// memberStats maps the memcached statistics exported for each member to their metrics
+	memberStats = []struct {
+		stat      string
+		desc      *prometheus.Desc
+		valueType prometheus.ValueType
+	}{
+		{"get_hits", prometheus.NewDesc("memcached_hits_total",
+			"Number of get requests that found the key.", statsLabels, nil), prometheus.CounterValue},
+		{"get_misses", prometheus.NewDesc("memcached_misses_total",
+			"Number of get requests that did not find the key.", statsLabels, nil), prometheus.CounterValue},
+		{"evictions", prometheus.NewDesc("memcached_evictions_total",
+			"Number of valid items removed from the cache to free memory for new items.", statsLabels, nil), prometheus.CounterValue},
+		{"bytes", prometheus.NewDesc("memcached_current_bytes",
+			"Number of bytes used to store items.", statsLabels, nil), prometheus.GaugeValue},
+		{"curr_items", prometheus.NewDesc("memcached_current_items",
+			"Number of items stored in the cache.", statsLabels, nil), prometheus.GaugeValue},
+		{"curr_connections", prometheus.NewDesc("memcached_current_connections",
+			"Number of open client connections.", statsLabels, nil), prometheus.GaugeValue},
+	}
+)
+
+// StatsCollector is a prometheus.Collector exporting the cache statistics of the members of every
+// Memcached. The members listed in the Memcached status are queried when the metrics are scraped,
+// concurrently but at most statsConcurrency at once, so collection never blocks reconciliation. The
+// credentials of the members are read within the same bound.
+type StatsCollector struct {
+	reader client.Reader
+	// secretReader reads the SASL credentials and CA bundles of the members from the API server
+	secretReader client.Reader
+	log          logr.Logger
+	// port is the port the members serve memcached on
+	port int
+}
+
+var _ prometheus.Collector = &StatsCollector{}
+
+// NewStatsCollector returns a StatsCollector listing the Memcacheds with the given reader. The SASL
+// credentials and CA bundles of the members are read with secretReader, which should not be backed by a cache so
+// the operator does not cache every Secret.
+func NewStatsCollector(reader, secretReader client.Reader, logger logr.Logger) *StatsCollector {
+	return &StatsCollector{reader: reader, secretReader: secretReader, log: logger, port: 11211}
+}
+
+// Describe implements prometheus.Collector
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- memberUpDesc
+	for _, s := range memberStats {
+		ch <- s.desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsCollectTimeout)
+	defer cancel()
+
+	list := &cachev1alpha1.MemcachedList{}
+	if err := c.reader.List(ctx, list); err != nil {
+		c.log.Error(err, "Failed to list Memcacheds for stats collection.")
+		return
+	}
+
+	sem := make(chan struct{}, statsConcurrency)
+	var wg sync.WaitGroup
+	var skipped int32
+	// acquire takes one of the statsConcurrency slots, or skips the given number of members once
+	// the collection timed out
+	acquire := func(n int) bool {
+		select {
+		case sem <- struct{}{}:
+			return true
+		case <-ctx.Done():
+			atomic.AddInt32(&skipped, int32(n))
+			return false
+		}
+	}
+	for i := range list.Items {
+		wg.Add(1)
+		go func(m *cachev1alpha1.Memcached) {
+			defer wg.Done()
+			var members []cachev1alpha1.MemberStatus
+			for _, member := range m.Status.Members {
+				if member.PodIP != "" {
+					members = append(members, member)
+				}
+			}
+			// Resolve the dialer within a slot and the timeout too, with SASL or TLS it reads
+			// Secrets from the API server
+			if len(members) == 0 || !acquire(len(members)) {
+				return
+			}
+			dialer, err := dialerForMemcached(ctx, c.secretReader, m)
+			<-sem
+			if err != nil {
+				c.log.Error(err, "Failed to read the member credentials for stats collection.", "Memcached.Namespace", m.Namespace, "Memcached.Name", m.Name)
+				return
+			}
+			for _, member := range members {
+				if !acquire(1) {
+					continue
+				}
+				wg.Add(1)
+				go func(member cachev1alpha1.MemberStatus) {
+					defer wg.Done()
+					defer func() { <-sem }()
+					c.collectMember(ch, m, member, dialer)
+				}(member)
+			}
+		}(&list.Items[i])
+	}
+	wg.Wait()
+	if skipped > 0 {
+		c.log.Info("Stats collection timed out, skipped members.", "Skipped", skipped)
+	}
+}
+
+// collectMember queries the stats of a member and sends its metrics.
+func (c *StatsCollector) collectMember(ch chan<- prometheus.Metric, m *cachev1alpha1.Memcached, member cachev1alpha1.MemberStatus, dialer *memberDialer) {
+	labels := []string{m.Namespace, m.Name, member.Name}
+	stats, err := c.memberStats(member, dialer)
+	if err != nil {
+		c.log.V(1).Info("Failed to collect member stats.", "Memcached.Namespace", m.Namespace, "Memcached.Name", m.Name, "Pod.Name", member.Name, "error", err.Error())
+		ch <- prometheus.MustNewConstMetric(memberUpDesc, prometheus.GaugeValue, 0, labels...)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(memberUpDesc, prometheus.GaugeValue, 1, labels...)
+	for _, s := range memberStats {
+		if v, ok := stats.Uint(s.stat); ok {
+			ch <- prometheus.MustNewConstMetric(s.desc, s.valueType, float64(v), labels...)
+		}
+	}
+}
+
+// memberStats returns the general-purpose statistics of a member, connecting to it with the given dialer.
+func (c *StatsCollector) memberStats(member cachev1alpha1.MemberStatus, dialer *memberDialer) (memcache.Stats, error) {
+	conn, err := dialer.dial(net.JoinHostPort(member.PodIP, strconv.Itoa(c.port)), statsMemberTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Stats()
+}
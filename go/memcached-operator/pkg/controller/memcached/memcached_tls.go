@@ -0,0 +1,503 @@
+package memcached
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// tlsDir is where the certificate Secret is mounted in the memcached container
+	tlsDir = "/etc/memcached/tls"
+	// caBundleKey is the key of the CA certificates clients should trust, in the certificate Secret
+	// and in the CA bundle ConfigMap
+	caBundleKey = "ca.crt"
+	// previousCAKey is the key of the CA Secret holding the certificate of the CA it replaced,
+	// kept in the CA bundle until it expires
+	previousCAKey = "previous.crt"
+	// caCertificateDuration is how long the CAs issued by the operator are valid
+	caCertificateDuration = 10 * 365 * 24 * time.Hour
+	// certificateBackdate is how long before their issuance certificates are valid, to tolerate clock skew
+	certificateBackdate = 5 * time.Minute
+	// clusterDomain is the DNS domain of the cluster the Service names of the certificates end with
+	clusterDomain = "cluster.local"
+)
+
+// caBundlePropagationPeriod is how long the certificate issued by the previous CA is still served
+// after a CA renewal, so the CA bundle trusting the new CA reaches the clients mounting it before
+// the members serve a certificate issued by it. It covers the sync of mounted ConfigMaps and Secrets
+// by the kubelet, and is a variable so tests can shorten it.
+var caBundlePropagationPeriod = 5 * time.Minute
+
+// tlsConfig is the certificate served by the members of a memcached CR
+type tlsConfig struct {
+	// hash identifies the certificate and key
+	hash string
+	// clientConfig is the TLS configuration the operator connects to the members with
+	clientConfig *tls.Config
+	// caBundle are the CA certificates clients should trust, empty when the certificate Secret
+	// has none and the members are verified against the system roots
+	caBundle []byte
+}
+
+// keyPair is a certificate with its private key, parsed and PEM encoded
+type keyPair struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// tlsSecretName returns the name of the Secret holding the certificate issued for the given memcached CR name.
+func tlsSecretName(name string) string {
+	return name + "-tls"
+}
+
+// caSecretName returns the name of the Secret holding the CA issued for the given memcached CR name.
+func caSecretName(name string) string {
+	return name + "-ca"
+}
+
+// caBundleConfigMapName returns the name of the ConfigMap publishing the CA bundle of the given memcached CR name.
+func caBundleConfigMapName(name string) string {
+	return name + "-ca-bundle"
+}
+
+// certificateSecretName returns the name of the Secret holding the certificate the members of the given memcached CR serve.
+func certificateSecretName(m *cachev1alpha1.Memcached) string {
+	if m.Spec.TLS != nil && m.Spec.TLS.SecretName != "" {
+		return m.Spec.TLS.SecretName
+	}
+	return tlsSecretName(m.Name)
+}
+
+// serviceDNSName returns the name of the Service of the given memcached CR the operator verifies the members for.
+func serviceDNSName(m *cachev1alpha1.Memcached) string {
+	return m.Name + "." + m.Namespace + ".svc"
+}
+
+// certificateDuration returns how long the certificates issued for the given memcached CR are valid.
+func certificateDuration(m *cachev1alpha1.Memcached) time.Duration {
+	if m.Spec.TLS == nil || m.Spec.TLS.CertificateDuration == nil {
+		return cachev1alpha1.DefaultCertificateDuration
+	}
+	if d := m.Spec.TLS.CertificateDuration.Duration; d > cachev1alpha1.MinCertificateDuration {
+		return d
+	}
+	return cachev1alpha1.MinCertificateDuration
+}
+
+// reconcileTLS returns the certificate the members of the given memcached CR serve, or nil when TLS
+// is disabled. Unless the certificate is read from the Secret named in the spec, the operator issues
+// it from a CA of its own, renews both before they expire and publishes the CA bundle in a ConfigMap.
+func (r *ReconcileMemcached) reconcileTLS(reqLogger logr.Logger, m *cachev1alpha1.Memcached) (*tlsConfig, error) {
+	if !m.Spec.TLSEnabled() || m.Spec.TLS.SecretName != "" {
+		if err := r.deleteIssuedCertificates(reqLogger, m); err != nil {
+			return nil, err
+		}
+	}
+	if !m.Spec.TLSEnabled() {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if m.Spec.TLS.SecretName == "" {
+		ca, bundle, err := r.reconcileCA(reqLogger, m)
+		if err != nil {
+			return nil, err
+		}
+		if secret, err = r.reconcileCertificate(reqLogger, m, ca, bundle); err != nil {
+			return nil, err
+		}
+		if err := r.reconcileCABundle(reqLogger, m, bundle); err != nil {
+			return nil, err
+		}
+	} else if err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: m.Spec.TLS.SecretName, Namespace: m.Namespace}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("TLS Secret %s not found", m.Spec.TLS.SecretName)
+		}
+		return nil, err
+	}
+
+	if len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		return nil, fmt.Errorf("TLS Secret %s has no %s or %s key", secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return &tlsConfig{
+		hash:         dataHash(secret.Data, corev1.TLSCertKey, corev1.TLSPrivateKeyKey),
+		clientConfig: clientTLSConfig(m, secret),
+		caBundle:     secret.Data[caBundleKey],
+	}, nil
+}
+
+// reconcileCA issues the CA of the given memcached CR, or a new one once the current one is due
+// for renewal. It returns the CA and the bundle of the CA certificates clients should trust: the
+// current one, and the one it replaced until it expires.
+func (r *ReconcileMemcached) reconcileCA(reqLogger logr.Logger, m *cachev1alpha1.Memcached) (*keyPair, []byte, error) {
+	found, exists, err := r.getOwnedSecret(m, caSecretName(m.Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	previous := found.Data[previousCAKey]
+	ca, err := parseKeyPair(found.Data[corev1.TLSCertKey], found.Data[corev1.TLSPrivateKeyKey])
+	if err != nil || renewalDue(ca.cert, now) {
+		if err == nil {
+			previous = ca.certPEM
+		}
+		if ca, err = issueCA(m, now); err != nil {
+			return nil, nil, err
+		}
+		data := map[string][]byte{
+			corev1.TLSCertKey:       ca.certPEM,
+			corev1.TLSPrivateKeyKey: ca.keyPEM,
+		}
+		if len(previous) > 0 {
+			data[previousCAKey] = previous
+		}
+		if err := r.writeTLSSecret(reqLogger, m, found, exists, r.tlsSecretForMemcached(m, caSecretName(m.Name), data)); err != nil {
+			return nil, nil, err
+		}
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Issued", "Issued CA certificate valid until %s", ca.cert.NotAfter.Format(time.RFC3339))
+	}
+
+	bundle := append([]byte{}, ca.certPEM...)
+	if cert, err := parseCertificate(previous); err == nil && now.Before(cert.NotAfter) {
+		bundle = append(bundle, previous...)
+	}
+	return ca, bundle, nil
+}
+
+// reconcileCertificate issues the certificate the members of the given memcached CR serve from its
+// CA, or a new one once the current one is due for renewal or was issued by another CA. After a CA
+// renewal, the certificate issued by the previous CA is kept until the CA bundle trusting the new
+// one is distributed. It returns the Secret holding the certificate, its key and the CA bundle.
+func (r *ReconcileMemcached) reconcileCertificate(reqLogger logr.Logger, m *cachev1alpha1.Memcached, ca *keyPair, bundle []byte) (*corev1.Secret, error) {
+	found, exists, err := r.getOwnedSecret(m, tlsSecretName(m.Name))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	dnsNames := dnsNamesForMemcached(m)
+	cert, err := parseKeyPair(found.Data[corev1.TLSCertKey], found.Data[corev1.TLSPrivateKeyKey])
+	if err == nil && caBundleDistributing(ca, bundle, cert, now) && reflect.DeepEqual(cert.cert.DNSNames, dnsNames) {
+		reqLogger.Info("Keeping the certificate issued by the previous CA until the CA bundle is distributed.", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+	} else if err != nil || renewalDue(cert.cert, now) || cert.cert.CheckSignatureFrom(ca.cert) != nil || !reflect.DeepEqual(cert.cert.DNSNames, dnsNames) {
+		notAfter := now.Add(certificateDuration(m))
+		if notAfter.After(ca.cert.NotAfter) {
+			notAfter = ca.cert.NotAfter
+		}
+		cert, err = issueKeyPair(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: serviceDNSName(m)},
+			DNSNames:    dnsNames,
+			NotBefore:   now.Add(-certificateBackdate),
+			NotAfter:    notAfter,
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca)
+		if err != nil {
+			return nil, err
+		}
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Issued", "Issued certificate valid until %s", cert.cert.NotAfter.Format(time.RFC3339))
+	}
+
+	secret := r.tlsSecretForMemcached(m, tlsSecretName(m.Name), map[string][]byte{
+		corev1.TLSCertKey:       cert.certPEM,
+		corev1.TLSPrivateKeyKey: cert.keyPEM,
+		caBundleKey:             bundle,
+	})
+	if exists && reflect.DeepEqual(found.Data, secret.Data) {
+		return found, nil
+	}
+	if err := r.writeTLSSecret(reqLogger, m, found, exists, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// reconcileCABundle publishes the CA bundle of the given memcached CR in a ConfigMap clients can mount.
+func (r *ReconcileMemcached) reconcileCABundle(reqLogger logr.Logger, m *cachev1alpha1.Memcached, bundle []byte) error {
+	found := &corev1.ConfigMap{}
+	err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: caBundleConfigMapName(m.Name), Namespace: m.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && !metav1.IsControlledBy(found, m) {
+		return fmt.Errorf("configmap %s already exists and is not owned by the Memcached", found.Name)
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      caBundleConfigMapName(m.Name),
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Data: map[string]string{caBundleKey: string(bundle)},
+	}
+	// Set Memcached instance as the owner of the ConfigMap.
+	controllerutil.SetControllerReference(m, configMap, r.scheme)
+	if !exists {
+		reqLogger.Info("Creating a new CA bundle ConfigMap.", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
+		if err := r.client.Create(context.TODO(), configMap); err != nil {
+			return err
+		}
+		recordOperation("ConfigMap", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created CA bundle ConfigMap %s", configMap.Name)
+		return nil
+	}
+	if reflect.DeepEqual(found.Data, configMap.Data) {
+		return nil
+	}
+	found.Data = configMap.Data
+	reqLogger.Info("Updating the CA bundle.", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		return err
+	}
+	recordOperation("ConfigMap", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated CA bundle ConfigMap %s", found.Name)
+	return nil
+}
+
+// deleteIssuedCertificates deletes the CA, certificate and CA bundle issued for the given memcached CR.
+func (r *ReconcileMemcached) deleteIssuedCertificates(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	objects := []struct {
+		kind string
+		obj  interface {
+			metav1.Object
+			runtime.Object
+		}
+		name string
+	}{
+		{"Secret", &corev1.Secret{}, tlsSecretName(m.Name)},
+		{"Secret", &corev1.Secret{}, caSecretName(m.Name)},
+		{"ConfigMap", &corev1.ConfigMap{}, caBundleConfigMapName(m.Name)},
+	}
+	for _, o := range objects {
+		err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: o.name, Namespace: m.Namespace}, o.obj)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(o.obj, m) {
+			continue
+		}
+		reqLogger.Info("Deleting issued TLS object.", o.kind+".Namespace", m.Namespace, o.kind+".Name", o.name)
+		if err := r.client.Delete(context.TODO(), o.obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		recordOperation(o.kind, "delete")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Deleted", "Deleted %s %s", o.kind, o.name)
+	}
+	return nil
+}
+
+// getOwnedSecret reads the named Secret of the given memcached CR from the API server, returning an
+// empty Secret when it does not exist and an error when it is not owned by the CR.
+func (r *ReconcileMemcached) getOwnedSecret(m *cachev1alpha1.Memcached, name string) (*corev1.Secret, bool, error) {
+	found := &corev1.Secret{}
+	err := r.apiReader.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: m.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &corev1.Secret{}, false, nil
+		}
+		return nil, false, err
+	}
+	if !metav1.IsControlledBy(found, m) {
+		return nil, false, fmt.Errorf("secret %s already exists and is not owned by the Memcached", found.Name)
+	}
+	return found, true, nil
+}
+
+// writeTLSSecret creates the given Secret, or updates the data of the found one when it exists.
+func (r *ReconcileMemcached) writeTLSSecret(reqLogger logr.Logger, m *cachev1alpha1.Memcached, found *corev1.Secret, exists bool, secret *corev1.Secret) error {
+	if !exists {
+		reqLogger.Info("Creating a new TLS Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Create(context.TODO(), secret); err != nil {
+			return err
+		}
+		recordOperation("Secret", "create")
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "Created", "Created TLS Secret %s", secret.Name)
+		return nil
+	}
+	found.Data = secret.Data
+	reqLogger.Info("Updating the TLS Secret.", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		return err
+	}
+	recordOperation("Secret", "update")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "Updated", "Updated TLS Secret %s", found.Name)
+	return nil
+}
+
+// tlsSecretForMemcached returns a TLS Secret of the given memcached CR with the given name and data.
+func (r *ReconcileMemcached) tlsSecretForMemcached(m *cachev1alpha1.Memcached, name string, data map[string][]byte) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: m.Namespace,
+			Labels:    labelsForMemcached(m.Name),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	// Set Memcached instance as the owner of the Secret.
+	controllerutil.SetControllerReference(m, secret, r.scheme)
+	return secret
+}
+
+// dnsNamesForMemcached returns the DNS names the certificate of the given memcached CR is issued
+// for: those of its Service, of its headless Service and of the members behind the headless Service.
+func dnsNamesForMemcached(m *cachev1alpha1.Memcached) []string {
+	var names []string
+	for _, service := range []string{m.Name, headlessServiceName(m.Name)} {
+		svc := service + "." + m.Namespace + ".svc"
+		names = append(names, service, service+"."+m.Namespace, svc, svc+"."+clusterDomain)
+	}
+	headless := headlessServiceName(m.Name) + "." + m.Namespace + ".svc"
+	return append(names, "*."+headless, "*."+headless+"."+clusterDomain)
+}
+
+// issueCA issues a self-signed CA for the given memcached CR.
+func issueCA(m *cachev1alpha1.Memcached, now time.Time) (*keyPair, error) {
+	return issueKeyPair(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("memcached CA %s/%s", m.Namespace, m.Name)},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              now.Add(caCertificateDuration),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, nil)
+}
+
+// issueKeyPair generates a key and a certificate for it from the given template, signed by the
+// parent key pair, or by itself when parent is nil.
+func issueKeyPair(template *x509.Certificate, parent *keyPair) (*keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return nil, err
+	}
+	issuer, signer := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+}
+
+// parseKeyPair parses a PEM encoded certificate and its private key.
+func parseKeyPair(certPEM, keyPEM []byte) (*keyPair, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", pair.PrivateKey)
+	}
+	return &keyPair{cert: cert, key: key, certPEM: certPEM, keyPEM: keyPEM}, nil
+}
+
+// parseCertificate parses the first certificate of the given PEM data.
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// caBundleDistributing reports whether the given certificate, issued by a CA of the given bundle
+// other than the given current CA, is still served at now because the bundle trusting the current
+// CA may not have reached the clients yet.
+func caBundleDistributing(ca *keyPair, bundle []byte, cert *keyPair, now time.Time) bool {
+	if cert.cert.CheckSignatureFrom(ca.cert) == nil || !now.Before(ca.cert.NotBefore.Add(certificateBackdate+caBundlePropagationPeriod)) {
+		return false
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(bundle)
+	_, err := cert.cert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	return err == nil
+}
+
+// renewalDue reports whether two thirds of the validity of the given certificate passed at now.
+func renewalDue(cert *x509.Certificate, now time.Time) bool {
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotBefore.Add(validity * 2 / 3))
+}
+
+// clientTLSConfig returns the TLS configuration the operator connects to the members of the given
+// memcached CR with. The members are verified for the name of the Service against the CA bundle of
+// their certificate Secret, or the system roots when it has none.
+func clientTLSConfig(m *cachev1alpha1.Memcached, secret *corev1.Secret) *tls.Config {
+	config := &tls.Config{ServerName: serviceDNSName(m)}
+	if bundle := secret.Data[caBundleKey]; len(bundle) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AppendCertsFromPEM(bundle)
+	}
+	return config
+}
+
+// addTLSToPodSpec mounts the certificate Secret of the given memcached CR into the memcached
+// container and makes memcached serve TLS only.
+func addTLSToPodSpec(m *cachev1alpha1.Memcached, spec *corev1.PodSpec) {
+	container := &spec.Containers[0]
+	container.Command = append(container.Command, "-Z", "-o",
+		"ssl_chain_cert="+tlsDir+"/"+corev1.TLSCertKey+",ssl_key="+tlsDir+"/"+corev1.TLSPrivateKeyKey)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "tls",
+		MountPath: tlsDir,
+		ReadOnly:  true,
+	})
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: certificateSecretName(m),
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+					{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+				},
+			},
+		},
+	})
+}
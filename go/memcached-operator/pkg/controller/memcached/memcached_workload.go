@@ -0,0 +1,170 @@
+package memcached
+
+import (
+	"context"
+	"fmt"
+
+	cachev1alpha1 "github.com/operator-framework/operator-sdk-samples/go/memcached-operator/pkg/apis/cache/v1alpha1"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// workloadStatus summarizes the rollout state of the Deployment or StatefulSet running the memcached pods
+type workloadStatus struct {
+	// kind is the kind of the workload, Deployment or StatefulSet
+	kind string
+	// replicas is the desired number of pods
+	replicas int32
+	// currentReplicas is the number of pods the workload currently runs
+	currentReplicas int32
+	readyReplicas   int32
+	// availableReplicas is the number of pods ready for at least minReadySeconds
+	availableReplicas int32
+	// updatedReplicas is the number of pods running the current pod template
+	updatedReplicas int32
+	// rolledOut is true when every desired pod runs the current pod template and is available
+	rolledOut bool
+	// deadlineExceeded is true when the rollout did not progress within its deadline
+	deadlineExceeded bool
+	// failureReason and failureMessage describe why the workload failed to create pods, if it did
+	failureReason  string
+	failureMessage string
+}
+
+// deploymentWorkloadStatus returns the rollout state of a memcached Deployment.
+func deploymentWorkloadStatus(dep *appsv1.Deployment) *workloadStatus {
+	ws := &workloadStatus{
+		kind:              "Deployment",
+		replicas:          1,
+		currentReplicas:   dep.Status.Replicas,
+		readyReplicas:     dep.Status.ReadyReplicas,
+		availableReplicas: dep.Status.AvailableReplicas,
+		updatedReplicas:   dep.Status.UpdatedReplicas,
+	}
+	if dep.Spec.Replicas != nil {
+		ws.replicas = *dep.Spec.Replicas
+	}
+	ws.rolledOut = dep.Status.ObservedGeneration >= dep.Generation &&
+		ws.updatedReplicas == ws.replicas &&
+		ws.currentReplicas == ws.replicas &&
+		ws.availableReplicas == ws.replicas
+	for _, c := range dep.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			ws.deadlineExceeded = true
+		} else if !(c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue) {
+			continue
+		}
+		ws.failureReason = c.Reason
+		ws.failureMessage = c.Message
+	}
+	return ws
+}
+
+// statefulSetWorkloadStatus returns the rollout state of a memcached StatefulSet.
+func statefulSetWorkloadStatus(sts *appsv1.StatefulSet) *workloadStatus {
+	ws := &workloadStatus{
+		kind:            "StatefulSet",
+		replicas:        1,
+		currentReplicas: sts.Status.Replicas,
+		readyReplicas:   sts.Status.ReadyReplicas,
+		// StatefulSets do not report available replicas, ready ones are the closest match
+		availableReplicas: sts.Status.ReadyReplicas,
+		updatedReplicas:   sts.Status.UpdatedReplicas,
+	}
+	if sts.Spec.Replicas != nil {
+		ws.replicas = *sts.Spec.Replicas
+	}
+	ws.rolledOut = sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdateRevision == sts.Status.CurrentRevision &&
+		ws.updatedReplicas == ws.replicas &&
+		ws.currentReplicas == ws.replicas &&
+		ws.readyReplicas == ws.replicas
+	return ws
+}
+
+// setConditions sets the Available, Progressing and Degraded conditions
+// of the memcached status from the state of its workload.
+func setConditions(status *cachev1alpha1.MemcachedStatus, ws *workloadStatus, generation int64) {
+	available := cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "MinimumReplicasAvailable",
+		Message:            fmt.Sprintf("%d/%d members are available", ws.availableReplicas, ws.replicas),
+	}
+	if ws.availableReplicas < ws.replicas {
+		available.Status = metav1.ConditionFalse
+		available.Reason = "MinimumReplicasUnavailable"
+	}
+	status.SetCondition(available)
+
+	degraded := cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "AsExpected",
+		Message:            fmt.Sprintf("The memcached %s is healthy", ws.kind),
+	}
+	if ws.failureReason != "" {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = ws.failureReason
+		degraded.Message = ws.failureMessage
+	}
+	status.SetCondition(degraded)
+
+	progressing := cachev1alpha1.Condition{
+		Type:               cachev1alpha1.ConditionProgressing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "RolloutComplete",
+		Message:            "All members run the current pod template",
+	}
+	if ws.deadlineExceeded {
+		progressing.Reason = "ProgressDeadlineExceeded"
+		progressing.Message = "The rollout did not complete within the progress deadline"
+	} else if !ws.rolledOut {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = "RollingOut"
+		progressing.Message = fmt.Sprintf("%d/%d members are updated", ws.updatedReplicas, ws.replicas)
+	}
+	status.SetCondition(progressing)
+}
+
+// deleteInactiveWorkload deletes the Deployment or StatefulSet owned by the memcached CR that
+// does not match its workload type, left behind after switching from one type to the other.
+func (r *ReconcileMemcached) deleteInactiveWorkload(reqLogger logr.Logger, m *cachev1alpha1.Memcached) error {
+	var inactive interface {
+		metav1.Object
+		runtime.Object
+	}
+	kind := "Deployment"
+	if m.Spec.WorkloadType == cachev1alpha1.WorkloadTypeStatefulSet {
+		inactive = &appsv1.Deployment{}
+	} else {
+		kind = "StatefulSet"
+		inactive = &appsv1.StatefulSet{}
+	}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, inactive)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(inactive, m) {
+		return nil
+	}
+	reqLogger.Info("Deleting the previous workload.", "Kind", kind, "Namespace", m.Namespace, "Name", m.Name)
+	if err := r.client.Delete(context.TODO(), inactive); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	recordOperation(kind, "delete")
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "WorkloadSwitched", "Deleted %s %s after the new workload rolled out", kind, m.Name)
+	return nil
+}